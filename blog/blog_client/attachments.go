@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+)
+
+// uploadChunkSize stays well under the 4MB default message size limit.
+const uploadChunkSize = 256 << 10
+
+// UploadAttachment streams a file to the server, attaching it to a blog when
+// one is given.
+func UploadAttachment(c blogpb.BlogServiceClient, args []string) {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	file := fs.String("file", "", "file to upload")
+	blogID := fs.String("blog", "", "id of the blog to attach the file to")
+	contentType := fs.String("type", "", "content type, used when the server cannot tell it from the content")
+	fs.Parse(args)
+
+	if *file == "" {
+		log.Fatalf("The upload command needs a file\n")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Error while opening the file: %v\n", err)
+	}
+	defer f.Close()
+
+	// the checksum lets the server catch a corrupted upload
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, f); err != nil {
+		log.Fatalf("Error while reading the file: %v\n", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		log.Fatalf("Error while reading the file: %v\n", err)
+	}
+
+	stream, err := c.UploadAttachment(context.Background())
+	if err != nil {
+		log.Fatalf("Error while calling UploadAttachment: %v\n", err)
+	}
+	err = stream.Send(&blogpb.UploadAttachmentRequest{
+		Data: &blogpb.UploadAttachmentRequest_Info_{Info: &blogpb.UploadAttachmentRequest_Info{
+			Filename:    filepath.Base(*file),
+			ContentType: *contentType,
+			BlogId:      *blogID,
+			Sha256:      hex.EncodeToString(checksum.Sum(nil)),
+		}},
+	})
+	if err != nil {
+		log.Fatalf("Error while sending the file info: %v\n", err)
+	}
+
+	buf := make([]byte, uploadChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			err := stream.Send(&blogpb.UploadAttachmentRequest{
+				Data: &blogpb.UploadAttachmentRequest_Chunk{Chunk: buf[:n]},
+			})
+			if err == io.EOF {
+				// the server gave up, CloseAndRecv returns why
+				break
+			}
+			if err != nil {
+				log.Fatalf("Error while sending the file: %v\n", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Error while reading the file: %v\n", err)
+		}
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		log.Fatalf("Error while uploading the file: %v\n", err)
+	}
+	log.Printf("Uploaded %v\n", res.GetAttachment())
+}
+
+// DownloadAttachment writes the content of an attachment to a file.
+func DownloadAttachment(c blogpb.BlogServiceClient, args []string) {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	id := fs.String("id", "", "id of the attachment")
+	out := fs.String("out", "", "output file, the attachment filename when empty")
+	fs.Parse(args)
+
+	stream, err := c.DownloadAttachment(context.Background(), &blogpb.DownloadAttachmentRequest{
+		AttachmentId: *id,
+	})
+	if err != nil {
+		log.Fatalf("Error while calling DownloadAttachment: %v\n", err)
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		log.Fatalf("Error while downloading the attachment: %v\n", err)
+	}
+	attachment := res.GetAttachment()
+	if *out == "" {
+		*out = filepath.Base(attachment.GetFilename())
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Error while creating the file: %v\n", err)
+	}
+	defer f.Close()
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a partial or corrupt file is worse than none
+			f.Close()
+			os.Remove(*out)
+			log.Fatalf("Error while downloading the attachment: %v\n", err)
+		}
+		if _, err := f.Write(res.GetChunk()); err != nil {
+			log.Fatalf("Error while writing the file: %v\n", err)
+		}
+	}
+	log.Printf("Downloaded %v (%v, %d bytes) to %v\n", attachment.GetFilename(), attachment.GetContentType(), attachment.GetSize(), *out)
+}
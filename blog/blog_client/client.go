@@ -5,14 +5,41 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 
 	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
 	"google.golang.org/grpc"
 )
 
+// headerCredentials sends the same metadata with every call.
+type headerCredentials map[string]string
+
+func (h headerCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return h, nil
+}
+
+// RequireTransportSecurity is false as the sample server has no TLS.
+func (h headerCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
 func main() {
 
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	headers := headerCredentials{}
+	// a server started with -auth token needs one of its tokens
+	if token := os.Getenv("BLOG_TOKEN"); token != "" {
+		headers["authorization"] = "Bearer " + token
+	}
+	// a server without authentication takes the tenant from the caller
+	if tenant := os.Getenv("BLOG_TENANT"); tenant != "" {
+		headers["x-tenant-id"] = tenant
+	}
+	if len(headers) > 0 {
+		opts = append(opts, grpc.WithPerRPCCredentials(headers))
+	}
+
+	cc, err := grpc.Dial("localhost:50051", opts...)
 	if err != nil {
 		log.Fatalf("could not connect to: %v\n", err)
 	}
@@ -20,6 +47,26 @@ func main() {
 
 	c := blogpb.NewBlogServiceClient(cc)
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			ExportBlogs(c, os.Args[2:])
+			return
+		case "import":
+			ImportBlogs(c, os.Args[2:])
+			return
+		case "upload":
+			UploadAttachment(c, os.Args[2:])
+			return
+		case "download":
+			DownloadAttachment(c, os.Args[2:])
+			return
+		default:
+			log.Fatalf("Unknown command %q, expected export, import, upload or download\n", os.Args[1])
+		}
+	}
+
+	// CreateAuthorUnary(blogpb.NewAuthorServiceClient(cc))
 	// CreateBlogUnary(c)
 	// ReadBlogUnary(c)
 	// UpdateBlogUnary(c)
@@ -28,14 +75,33 @@ func main() {
 
 }
 
+func CreateAuthorUnary(c blogpb.AuthorServiceClient) {
+	fmt.Println("Creating an author...")
+
+	authorRequest := blogpb.CreateAuthorRequest{
+		Author: &blogpb.Author{
+			Id:          "bogdan-copocean",
+			DisplayName: "Bogdan Copocean",
+		},
+	}
+
+	res, err := c.CreateAuthor(context.Background(), &authorRequest)
+	if err != nil {
+		log.Fatalf("Error while creating the author: %v\n", err)
+	}
+
+	log.Printf("Response from CreateAuthor RPC: %v\n", res.Author)
+}
+
 func CreateBlogUnary(c blogpb.BlogServiceClient) {
 	fmt.Println("Creating a blog post...")
 
 	blogRequest := blogpb.CreateBlogRequest{
 		Blog: &blogpb.Blog{
-			AuthorId: "Bogdan Copocean",
+			AuthorId: "bogdan-copocean",
 			Title:    "My Fourth Blog",
 			Content:  "Content from the fourth blog",
+			Status:   blogpb.Blog_PUBLISHED,
 		},
 	}
 
@@ -70,7 +136,7 @@ func UpdateBlogUnary(c blogpb.BlogServiceClient) {
 	blogRequest := blogpb.UpdateBlogRequest{
 		Blog: &blogpb.Blog{
 			Id:       blogID,
-			AuthorId: "Changed",
+			AuthorId: "bogdan-copocean",
 			Title:    "Changed",
 			Content:  "Changed",
 		},
@@ -106,27 +172,40 @@ func DeleteBlogUnary(c blogpb.BlogServiceClient) {
 func ListAllBlogUnary(c blogpb.BlogServiceClient) {
 	fmt.Println("List blogs...")
 
-	blogRequest := blogpb.ListBlogRequest{}
-
-	stream, err := c.ListBlog(context.Background(), &blogRequest)
-
-	if err != nil {
-		log.Fatalf("Error while listing the blogs: %v\n", err)
+	blogRequest := blogpb.ListBlogRequest{
+		PageSize:  10,
+		BatchSize: 5,
 	}
 
 	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
+		stream, err := c.ListBlog(context.Background(), &blogRequest)
 
 		if err != nil {
-			log.Fatalf("Error while receiving: %v\n", err)
-			break
+			log.Fatalf("Error while listing the blogs: %v\n", err)
 		}
 
-		log.Printf("Response from ListAllBlog RPC: %v\n", res.Blog)
+		nextPageToken := ""
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatalf("Error while receiving: %v\n", err)
+				break
+			}
+
+			for _, blog := range res.GetBlogs() {
+				log.Printf("Response from ListAllBlog RPC: %v\n", blog)
+			}
+			nextPageToken = res.GetNextPageToken()
+		}
 
+		if nextPageToken == "" {
+			break
+		}
+		blogRequest.PageToken = nextPageToken
 	}
 	log.Println("ListAllBlog RPC done")
 
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	formatJSONL    = "jsonl"
+	formatMarkdown = "markdown"
+
+	// importBatchSize is how many blogs import sends in one batch request.
+	importBatchSize = 500
+	// maxLineSize bounds a single JSON Lines record.
+	maxLineSize = 16 << 20
+)
+
+// ExportBlogs writes every blog to a JSON Lines file or to a directory of
+// Markdown files with front matter.
+func ExportBlogs(c blogpb.BlogServiceClient, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", formatJSONL, "output format: jsonl or markdown")
+	out := fs.String("out", "", "output file for jsonl (stdout when empty), output directory for markdown")
+	fs.Parse(args)
+
+	var write func(blog *blogpb.Blog) error
+	switch *format {
+	case formatJSONL:
+		f := os.Stdout
+		if *out != "" {
+			var err error
+			f, err = os.Create(*out)
+			if err != nil {
+				log.Fatalf("Error while creating the export file: %v\n", err)
+			}
+			defer f.Close()
+		}
+		w := bufio.NewWriter(f)
+		defer func() {
+			if err := w.Flush(); err != nil {
+				log.Fatalf("Error while writing the export file: %v\n", err)
+			}
+		}()
+		write = func(blog *blogpb.Blog) error {
+			line, err := protojson.Marshal(blog)
+			if err != nil {
+				return err
+			}
+			w.Write(line)
+			return w.WriteByte('\n')
+		}
+	case formatMarkdown:
+		if *out == "" {
+			log.Fatalf("The markdown format needs an output directory\n")
+		}
+		if err := os.MkdirAll(*out, 0755); err != nil {
+			log.Fatalf("Error while creating the export directory: %v\n", err)
+		}
+		write = func(blog *blogpb.Blog) error {
+			return os.WriteFile(filepath.Join(*out, blog.GetId()+".md"), marshalMarkdown(blog), 0644)
+		}
+	default:
+		log.Fatalf("Unknown export format %q\n", *format)
+	}
+
+	blogRequest := blogpb.ListBlogRequest{
+		PageSize: 100,
+	}
+	// drafts and archived blogs belong in a backup too
+	for s := range blogpb.Blog_Status_name {
+		if s != int32(blogpb.Blog_STATUS_UNSPECIFIED) {
+			blogRequest.Statuses = append(blogRequest.Statuses, blogpb.Blog_Status(s))
+		}
+	}
+
+	count := 0
+	for {
+		stream, err := c.ListBlog(context.Background(), &blogRequest)
+		if err != nil {
+			log.Fatalf("Error while listing the blogs: %v\n", err)
+		}
+
+		nextPageToken := ""
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatalf("Error while receiving: %v\n", err)
+			}
+
+			if err := write(res.GetBlog()); err != nil {
+				log.Fatalf("Error while exporting the blog with the id %v: %v\n", res.GetBlog().GetId(), err)
+			}
+			count++
+			nextPageToken = res.GetNextPageToken()
+		}
+
+		if nextPageToken == "" {
+			break
+		}
+		blogRequest.PageToken = nextPageToken
+	}
+	log.Printf("Exported %d blogs\n", count)
+}
+
+// ImportBlogs reads blogs written by ExportBlogs and upserts them by id, so
+// importing the same export twice leaves a single copy of every blog. Blogs
+// without an id are created.
+func ImportBlogs(c blogpb.BlogServiceClient, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", formatJSONL, "input format: jsonl or markdown")
+	in := fs.String("in", "", "input file for jsonl (stdin when empty), input directory for markdown")
+	fs.Parse(args)
+
+	imp := &importer{c: c}
+
+	switch *format {
+	case formatJSONL:
+		f := os.Stdin
+		if *in != "" {
+			var err error
+			f, err = os.Open(*in)
+			if err != nil {
+				log.Fatalf("Error while opening the import file: %v\n", err)
+			}
+			defer f.Close()
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, maxLineSize)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			blog := &blogpb.Blog{}
+			if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(scanner.Bytes(), blog); err != nil {
+				log.Fatalf("Error while parsing line %d: %v\n", line, err)
+			}
+			if blog.GetStatus() == blogpb.Blog_STATUS_UNSPECIFIED {
+				// exports made while PUBLISHED was the zero value leave it out
+				blog.Status = blogpb.Blog_PUBLISHED
+			}
+			imp.add(blog)
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Error while reading the import file: %v\n", err)
+		}
+	case formatMarkdown:
+		if *in == "" {
+			log.Fatalf("The markdown format needs an input directory\n")
+		}
+		files, err := filepath.Glob(filepath.Join(*in, "*.md"))
+		if err != nil {
+			log.Fatalf("Error while listing the import directory: %v\n", err)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("Error while reading %v: %v\n", file, err)
+			}
+			blog, err := unmarshalMarkdown(data)
+			if err != nil {
+				log.Fatalf("Error while parsing %v: %v\n", file, err)
+			}
+			imp.add(blog)
+		}
+	default:
+		log.Fatalf("Unknown import format %q\n", *format)
+	}
+	imp.flush()
+
+	log.Printf("Imported %d blogs, %d failed\n", imp.imported, imp.failed)
+}
+
+// importer sends blogs to the server in batches.
+type importer struct {
+	c       blogpb.BlogServiceClient
+	pending []*blogpb.Blog
+
+	imported, failed int
+}
+
+func (imp *importer) add(blog *blogpb.Blog) {
+	imp.pending = append(imp.pending, blog)
+	if len(imp.pending) == importBatchSize {
+		imp.flush()
+	}
+}
+
+func (imp *importer) flush() {
+	var creates []*blogpb.Blog
+	var upserts []*blogpb.UpdateBlogRequest
+	for _, blog := range imp.pending {
+		if blog.GetId() == "" {
+			creates = append(creates, blog)
+			continue
+		}
+		upserts = append(upserts, &blogpb.UpdateBlogRequest{
+			Blog:         blog,
+			AllowMissing: true,
+		})
+	}
+	imp.pending = nil
+
+	if len(upserts) > 0 {
+		res, err := imp.c.BatchUpdateBlogs(context.Background(), &blogpb.BatchUpdateBlogsRequest{
+			Requests: upserts,
+		})
+		if err != nil {
+			log.Fatalf("Error while importing the blogs: %v\n", err)
+		}
+		for i, result := range res.GetResults() {
+			imp.count(upserts[i].GetBlog().GetId(), result)
+		}
+	}
+	if len(creates) > 0 {
+		res, err := imp.c.BatchCreateBlogs(context.Background(), &blogpb.BatchCreateBlogsRequest{
+			Blogs: creates,
+		})
+		if err != nil {
+			log.Fatalf("Error while importing the blogs: %v\n", err)
+		}
+		for i, result := range res.GetResults() {
+			imp.count(creates[i].GetTitle(), result)
+		}
+	}
+}
+
+func (imp *importer) count(name string, result *blogpb.BatchBlogResult) {
+	if codes.Code(result.GetStatus().GetCode()) != codes.OK {
+		log.Printf("Error while importing the blog %v: %v\n", name, result.GetStatus().GetMessage())
+		imp.failed++
+		return
+	}
+	imp.imported++
+}
+
+// marshalMarkdown renders blog as its content preceded by YAML front matter
+// holding the other fields.
+func marshalMarkdown(blog *blogpb.Blog) []byte {
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", strconv.Quote(blog.GetId()))
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(blog.GetTitle()))
+	fmt.Fprintf(&b, "author_id: %s\n", strconv.Quote(blog.GetAuthorId()))
+	if blog.GetSlug() != "" {
+		fmt.Fprintf(&b, "slug: %s\n", strconv.Quote(blog.GetSlug()))
+	}
+	if blog.GetCategory() != "" {
+		fmt.Fprintf(&b, "category: %s\n", strconv.Quote(blog.GetCategory()))
+	}
+	if len(blog.GetTags()) > 0 {
+		b.WriteString("tags:\n")
+		for _, tag := range blog.GetTags() {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(tag))
+		}
+	}
+	fmt.Fprintf(&b, "status: %s\n", strings.ToLower(blog.GetStatus().String()))
+	if blog.GetContentFormat() != blogpb.Blog_PLAIN {
+		fmt.Fprintf(&b, "content_format: %s\n", strings.ToLower(blog.GetContentFormat().String()))
+	}
+	if blog.GetPublishAt() != nil {
+		fmt.Fprintf(&b, "publish_at: %s\n", blog.GetPublishAt().AsTime().Format(time.RFC3339Nano))
+	}
+	if blog.GetCreatedAt() != nil {
+		fmt.Fprintf(&b, "created_at: %s\n", blog.GetCreatedAt().AsTime().Format(time.RFC3339Nano))
+	}
+	if blog.GetUpdatedAt() != nil {
+		fmt.Fprintf(&b, "updated_at: %s\n", blog.GetUpdatedAt().AsTime().Format(time.RFC3339Nano))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(blog.GetContent())
+	return b.Bytes()
+}
+
+// unmarshalMarkdown parses a file written by marshalMarkdown. The front
+// matter is read as "key: value" pairs, or a key followed by "- value" list
+// items, double-quoted values being unescaped.
+func unmarshalMarkdown(data []byte) (*blogpb.Blog, error) {
+	text := string(data)
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, fmt.Errorf("missing front matter")
+	}
+	end := strings.Index(text[4:], "\n---\n")
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated front matter")
+	}
+	header := text[4 : 4+end]
+	content := strings.TrimPrefix(text[4+end+len("\n---\n"):], "\n")
+
+	blog := &blogpb.Blog{Content: content}
+	key := ""
+	for _, line := range strings.Split(header, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// a list item belongs to the last key
+		if strings.HasPrefix(trimmed, "- ") {
+			value, err := unquoteFrontMatter(key, strings.TrimSpace(trimmed[2:]))
+			if err != nil {
+				return nil, err
+			}
+			if key == "tags" {
+				blog.Tags = append(blog.Tags, value)
+			}
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid front matter line %q", line)
+		}
+		key = strings.TrimSpace(parts[0])
+		value, err := unquoteFrontMatter(key, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "id":
+			blog.Id = value
+		case "title":
+			blog.Title = value
+		case "author_id":
+			blog.AuthorId = value
+		case "slug":
+			blog.Slug = value
+		case "category":
+			blog.Category = value
+		case "status":
+			s, ok := blogpb.Blog_Status_value[strings.ToUpper(value)]
+			if !ok {
+				return nil, fmt.Errorf("invalid value of %v: %q", key, value)
+			}
+			blog.Status = blogpb.Blog_Status(s)
+		case "content_format":
+			f, ok := blogpb.Blog_ContentFormat_value[strings.ToUpper(value)]
+			if !ok {
+				return nil, fmt.Errorf("invalid value of %v: %q", key, value)
+			}
+			blog.ContentFormat = blogpb.Blog_ContentFormat(f)
+		case "created_at", "updated_at", "publish_at":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %v: %v", key, err)
+			}
+			switch key {
+			case "created_at":
+				blog.CreatedAt = timestamppb.New(t)
+			case "updated_at":
+				blog.UpdatedAt = timestamppb.New(t)
+			default:
+				blog.PublishAt = timestamppb.New(t)
+			}
+		}
+	}
+	return blog, nil
+}
+
+func unquoteFrontMatter(key, value string) (string, error) {
+	if !strings.HasPrefix(value, `"`) {
+		return value, nil
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid value of %v: %v", key, err)
+	}
+	return unquoted, nil
+}
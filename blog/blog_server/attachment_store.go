@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrAttachmentNotFound is returned when no attachment has the given id.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrAttachmentTooLarge is returned by the reader of an upload going past
+	// the size limit.
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+)
+
+// AttachmentItem describes an attachment whose content is kept by an
+// AttachmentStore.
+type AttachmentItem struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	BlogID      primitive.ObjectID `bson:"blog_id,omitempty"`
+	Filename    string             `bson:"filename"`
+	ContentType string             `bson:"content_type"`
+	Size        int64              `bson:"size"`
+	// SHA256 is the hex-encoded checksum of the content.
+	SHA256    string    `bson:"sha256"`
+	CreatedAt time.Time `bson:"created_at"`
+	// Tenant is the namespace of the uploader, missing for the default one.
+	Tenant string `bson:"tenant,omitempty"`
+}
+
+// AttachmentStore keeps the content of attachments next to their
+// description.
+type AttachmentStore interface {
+	// Put stores the content read from r as the attachment item, whose ID
+	// must be set, and returns it with its Size and SHA256. An attachment is
+	// only found once it has been stored completely, and a failed read leaves
+	// nothing behind.
+	Put(ctx context.Context, item *AttachmentItem, r io.Reader) (*AttachmentItem, error)
+	// Get returns the attachment with the given id or ErrAttachmentNotFound.
+	Get(ctx context.Context, id primitive.ObjectID) (*AttachmentItem, error)
+	// Open returns the content of the attachment with the given id or
+	// ErrAttachmentNotFound.
+	Open(ctx context.Context, id primitive.ObjectID) (io.ReadCloser, error)
+	// Delete removes the attachment with the given id or returns
+	// ErrAttachmentNotFound.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Usage returns the total size of the attachments of tenant.
+	Usage(ctx context.Context, tenant string) (int64, error)
+}
+
+// checksumReader counts and hashes what is read through it.
+type checksumReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func newChecksumReader(r io.Reader) *checksumReader {
+	return &checksumReader{r: r, hash: sha256.New()}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	c.size += int64(n)
+	return n, err
+}
+
+// sum returns the hex-encoded SHA-256 of what has been read so far.
+func (c *checksumReader) sum() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// forEachAttachmentStore runs test against an empty store of every
+// attachment backend.
+func forEachAttachmentStore(t *testing.T, test func(t *testing.T, store AttachmentStore)) {
+	t.Run("dir", func(t *testing.T) {
+		store, err := NewDirAttachmentStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, store)
+	})
+	t.Run("gridfs", func(t *testing.T) {
+		store, err := NewGridFSAttachmentStore(newTestMongoDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, store)
+	})
+}
+
+// failingReader returns its content and then fails.
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestAttachmentStore(t *testing.T) {
+	forEachAttachmentStore(t, func(t *testing.T, store AttachmentStore) {
+		ctx := context.Background()
+		item := &AttachmentItem{
+			ID:          primitive.NewObjectID(),
+			BlogID:      primitive.NewObjectID(),
+			Filename:    "notes.txt",
+			ContentType: "text/plain; charset=utf-8",
+			CreatedAt:   time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+		put, err := store.Put(ctx, item, strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		if put.Size != 5 || put.SHA256 != helloSHA256 {
+			t.Errorf("Put = size %d sha256 %s, want 5 and %s", put.Size, put.SHA256, helloSHA256)
+		}
+
+		got, err := store.Get(ctx, item.ID)
+		if err != nil || got.Filename != item.Filename || got.BlogID != item.BlogID || got.Size != 5 {
+			t.Errorf("Get = %+v, %v, want %+v", got, err, put)
+		}
+		r, err := store.Open(ctx, item.ID)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(content) != "hello" {
+			t.Errorf("content = %q, %v, want hello", content, err)
+		}
+
+		failed := &AttachmentItem{ID: primitive.NewObjectID(), Filename: "broken"}
+		if _, err := store.Put(ctx, failed, &failingReader{bytes.NewReader(make([]byte, 1<<16))}); err == nil {
+			t.Errorf("Put of a failing upload succeeded")
+		}
+		if _, err := store.Get(ctx, failed.ID); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("Get of a failed upload: error = %v, want %v", err, ErrAttachmentNotFound)
+		}
+
+		if err := store.Delete(ctx, item.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Get(ctx, item.ID); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("Get after Delete: error = %v, want %v", err, ErrAttachmentNotFound)
+		}
+		if _, err := store.Open(ctx, item.ID); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("Open after Delete: error = %v, want %v", err, ErrAttachmentNotFound)
+		}
+		if err := store.Delete(ctx, item.ID); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("Delete twice: error = %v, want %v", err, ErrAttachmentNotFound)
+		}
+	})
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	tests := []struct {
+		head     []byte
+		declared string
+		want     string
+	}{
+		{[]byte("\x89PNG\r\n\x1a\n"), "text/plain", "image/png"},
+		{[]byte{0, 1, 2}, "application/x-custom; v=1", "application/x-custom; v=1"},
+		{[]byte{0, 1, 2}, "not a type;;", "application/octet-stream"},
+		{[]byte{0, 1, 2}, "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := attachmentContentType(tt.head, tt.declared); got != tt.want {
+			t.Errorf("attachmentContentType(%q, %q) = %q, want %q", tt.head, tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentFilename(t *testing.T) {
+	for name, want := range map[string]string{
+		"notes.txt":            "notes.txt",
+		" dir/notes.txt ":      "notes.txt",
+		`C:\Users\ann\pic.png`: "pic.png",
+		"/":                    "",
+		"":                     "",
+	} {
+		if got := attachmentFilename(name); got != want {
+			t.Errorf("attachmentFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
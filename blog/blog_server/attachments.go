@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// downloadChunkSize is the size of the content chunks DownloadAttachment
+	// sends.
+	downloadChunkSize = 64 << 10
+	// sniffLength is how much of the content is looked at to find its type.
+	sniffLength = 512
+)
+
+// errMisplacedInfo is returned by an uploadReader meeting a second info
+// message.
+var errMisplacedInfo = errors.New("only the first upload message can hold the info")
+
+func dataToAttachmentPb(data *AttachmentItem) *blogpb.Attachment {
+	attachment := &blogpb.Attachment{
+		Id:          data.ID.Hex(),
+		Filename:    data.Filename,
+		ContentType: data.ContentType,
+		Size:        data.Size,
+		Sha256:      data.SHA256,
+		CreatedAt:   timestamppb.New(data.CreatedAt),
+	}
+	if !data.BlogID.IsZero() {
+		attachment.BlogId = data.BlogID.Hex()
+	}
+	return attachment
+}
+
+// uploadReader reads the content chunks of an upload stream, failing with
+// ErrAttachmentTooLarge once more than limit bytes have arrived.
+type uploadReader struct {
+	stream blogpb.BlogService_UploadAttachmentServer
+	limit  int64
+	read   int64
+	chunk  []byte
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	for len(u.chunk) == 0 {
+		req, err := u.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.GetInfo() != nil {
+			return 0, errMisplacedInfo
+		}
+		u.chunk = req.GetChunk()
+		u.read += int64(len(u.chunk))
+		if u.read > u.limit {
+			return 0, ErrAttachmentTooLarge
+		}
+	}
+	n := copy(p, u.chunk)
+	u.chunk = u.chunk[n:]
+	return n, nil
+}
+
+// uploadError maps an error met while reading or storing an upload to a
+// gRPC status error.
+func (s *server) uploadError(err error) error {
+	if errors.Is(err, ErrAttachmentTooLarge) {
+		return status.Errorf(codes.ResourceExhausted, "Attachment is larger than %d bytes\n", s.maxAttachmentSize)
+	}
+	if errors.Is(err, errMisplacedInfo) {
+		return status.Errorf(codes.InvalidArgument, "Invalid upload: %v\n", err)
+	}
+	if _, ok := status.FromError(err); ok {
+		// the stream failed, the client is likely gone
+		return err
+	}
+	return storeError(err)
+}
+
+// attachmentContentType sniffs the type of content from its first bytes,
+// keeping the declared type only when sniffing finds nothing more specific
+// than binary data.
+func attachmentContentType(head []byte, declared string) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" || declared == "" {
+		return sniffed
+	}
+	mediaType, params, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return sniffed
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// attachmentFilename keeps the last element of a client path.
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+func (s *server) UploadAttachment(stream blogpb.BlogService_UploadAttachmentServer) error {
+	fmt.Println("UploadAttachment invoked")
+
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Errorf(codes.InvalidArgument, "Upload has no info\n")
+	}
+	if err != nil {
+		return err
+	}
+	info := req.GetInfo()
+	if info == nil {
+		return status.Errorf(codes.InvalidArgument, "The first upload message must hold the info\n")
+	}
+	if err := validate(info); err != nil {
+		return err
+	}
+
+	item := &AttachmentItem{
+		ID:        primitive.NewObjectID(),
+		Filename:  attachmentFilename(info.GetFilename()),
+		CreatedAt: now(),
+		Tenant:    TenantFromContext(ctx),
+	}
+	if info.GetBlogId() != "" {
+		oid, err := primitive.ObjectIDFromHex(info.GetBlogId())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "Cannot parse blog id: %v\n", err)
+		}
+		// fail before the content is sent
+		blog, err := liveBlog(ctx, s.store, oid)
+		if err != nil {
+			return storeError(err)
+		}
+		if err := s.policy.Authorize(ctx, ActionUpdate, blog); err != nil {
+			return err
+		}
+		item.BlogID = oid
+	} else if err := s.policy.RequireIdentity(ctx); err != nil {
+		// an upload tied to no blog still uses up the storage of the tenant
+		return err
+	}
+
+	content := &uploadReader{stream: stream, limit: s.maxAttachmentSize}
+	// the upload stops where the tenant runs out of storage
+	left, err := s.storageLeft(ctx, s.store)
+	if err != nil {
+		return err
+	}
+	quotaBound := left >= 0 && left < content.limit
+	if quotaBound {
+		content.limit = left
+	}
+	uploadError := func(err error) error {
+		if quotaBound && errors.Is(err, ErrAttachmentTooLarge) {
+			return status.Errorf(codes.ResourceExhausted, "Quota exceeded: the attachment is larger than the %d bytes left\n", left)
+		}
+		return s.uploadError(err)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return uploadError(err)
+	}
+	if n == 0 {
+		return status.Errorf(codes.InvalidArgument, "Attachment is empty\n")
+	}
+	head = head[:n]
+	item.ContentType = attachmentContentType(head, info.GetContentType())
+
+	stored, err := s.attachments.Put(ctx, item, io.MultiReader(bytes.NewReader(head), content))
+	if err != nil {
+		return uploadError(err)
+	}
+
+	if want := info.GetSha256(); want != "" && !strings.EqualFold(want, stored.SHA256) {
+		s.attachments.Delete(ctx, stored.ID)
+		return status.Errorf(codes.DataLoss, "Checksum mismatch: the content has %v, expected %v\n", stored.SHA256, want)
+	}
+
+	if !stored.BlogID.IsZero() {
+		_, err := updateWithHistory(ctx, s.store, stored.BlogID, BlogUpdate{
+			Attachment: &stored.ID,
+			UpdatedAt:  now(),
+		})
+		if err != nil {
+			s.attachments.Delete(ctx, stored.ID)
+			return storeError(err)
+		}
+	}
+
+	return stream.SendAndClose(&blogpb.UploadAttachmentResponse{
+		Attachment: dataToAttachmentPb(stored),
+	})
+}
+
+func (s *server) DownloadAttachment(req *blogpb.DownloadAttachmentRequest, stream blogpb.BlogService_DownloadAttachmentServer) error {
+	fmt.Println("DownloadAttachment invoked")
+
+	if err := validate(req); err != nil {
+		return err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetAttachmentId())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Cannot parse id: %v\n", err)
+	}
+
+	ctx := stream.Context()
+	data, err := s.attachments.Get(ctx, oid)
+	if err == nil && data.Tenant != TenantFromContext(ctx) {
+		err = ErrAttachmentNotFound
+	}
+	if err != nil {
+		return storeError(err)
+	}
+	content, err := s.attachments.Open(ctx, oid)
+	if err != nil {
+		return storeError(err)
+	}
+	defer content.Close()
+
+	err = stream.Send(&blogpb.DownloadAttachmentResponse{
+		Data: &blogpb.DownloadAttachmentResponse_Attachment{Attachment: dataToAttachmentPb(data)},
+	})
+	if err != nil {
+		return err
+	}
+
+	checksum := sha256.New()
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := io.ReadFull(content, buf)
+		if n > 0 {
+			checksum.Write(buf[:n])
+			err := stream.Send(&blogpb.DownloadAttachmentResponse{
+				Data: &blogpb.DownloadAttachmentResponse_Chunk{Chunk: buf[:n]},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Cannot read the attachment: %v\n", err)
+		}
+	}
+
+	// the client has the content by now, but can still tell it is corrupt
+	if sum := hex.EncodeToString(checksum.Sum(nil)); sum != data.SHA256 {
+		return status.Errorf(codes.DataLoss, "Attachment content has the checksum %v, expected %v\n", sum, data.SHA256)
+	}
+	return nil
+}
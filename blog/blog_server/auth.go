@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject is the author id the caller acts as.
+	Subject string
+	Roles   []string
+	// Tenant is the namespace the caller works in, empty for the default
+	// one.
+	Tenant string
+}
+
+func (id *Identity) HasRole(role string) bool {
+	if id == nil {
+		return false
+	}
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying the caller identity.
+func ContextWithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller identity of a request, or nil when
+// the caller is anonymous.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// Authenticator finds out who the caller of a request is.
+type Authenticator interface {
+	// Authenticate returns the caller identity, nil for a caller sending no
+	// credentials, or an UNAUTHENTICATED error for bad credentials.
+	Authenticate(ctx context.Context) (*Identity, error)
+}
+
+// tokenAuthenticator accepts bearer tokens from a fixed list.
+type tokenAuthenticator struct {
+	tokens map[string]*Identity
+}
+
+// NewTokenAuthenticator returns an Authenticator checking the bearer token
+// of the authorization metadata against the file at path. Each line of the
+// file holds a token, the author id it authenticates and optionally a comma
+// separated list of roles, "-" for none, and a tenant; blank lines and lines
+// starting with # are skipped.
+func NewTokenAuthenticator(path string) (Authenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &tokenAuthenticator{tokens: make(map[string]*Identity)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("%s:%d: expected a token, an author id, and optional roles and tenant", path, line)
+		}
+		id := &Identity{Subject: fields[1]}
+		if len(fields) >= 3 && fields[2] != "-" {
+			id.Roles = strings.Split(fields[2], ",")
+		}
+		if len(fields) == 4 {
+			id.Tenant = fields[3]
+		}
+		a.tokens[fields[0]] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *tokenAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, nil
+	}
+	const prefix = "bearer "
+	if len(values[0]) < len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return nil, status.Errorf(codes.Unauthenticated, "Expected a bearer token\n")
+	}
+	token := values[0][len(prefix):]
+	for known, id := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return id, nil
+		}
+	}
+	return nil, status.Errorf(codes.Unauthenticated, "Unknown token\n")
+}
+
+// headerAuthenticator trusts the identity set by a proxy in front of the
+// server, which must strip these headers from client requests.
+type headerAuthenticator struct{}
+
+// NewHeaderAuthenticator returns an Authenticator reading the caller from
+// the x-user-id metadata, its roles from x-user-roles and its tenant from
+// x-tenant-id, for servers only reachable through an authenticating proxy.
+func NewHeaderAuthenticator() Authenticator {
+	return headerAuthenticator{}
+}
+
+func (headerAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	subjects := md.Get("x-user-id")
+	if len(subjects) == 0 || subjects[0] == "" {
+		return nil, nil
+	}
+	id := &Identity{Subject: subjects[0]}
+	if tenants := md.Get(tenantHeader); len(tenants) > 0 {
+		id.Tenant = tenants[0]
+	}
+	for _, roles := range md.Get("x-user-roles") {
+		for _, r := range strings.Split(roles, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				id.Roles = append(id.Roles, r)
+			}
+		}
+	}
+	return id, nil
+}
+
+// AuthUnaryInterceptor stores the identity found by a in the context of
+// every unary call.
+func AuthUnaryInterceptor(a Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id, err := a.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ContextWithIdentity(ctx, id), req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of
+// AuthUnaryInterceptor.
+func AuthStreamInterceptor(a Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id, err := a.Authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ContextWithIdentity(ss.Context(), id)})
+	}
+}
+
+// contextStream is a server stream whose context was replaced by an
+// interceptor.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
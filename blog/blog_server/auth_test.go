@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.txt")
+	tokens := "# token subject roles\nt-ann ann\n\nt-root root admin,editor\n"
+	if err := ioutil.WriteFile(path, []byte(tokens), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewTokenAuthenticator(path)
+	if err != nil {
+		t.Fatalf("NewTokenAuthenticator: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		want     *Identity
+		wantCode codes.Code
+	}{
+		{"no credentials", "", nil, codes.OK},
+		{"author", "Bearer t-ann", &Identity{Subject: "ann"}, codes.OK},
+		{"roles", "bearer t-root", &Identity{Subject: "root", Roles: []string{"admin", "editor"}}, codes.OK},
+		{"unknown token", "Bearer t-eve", nil, codes.Unauthenticated},
+		{"other scheme", "Basic dDphbm4=", nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.header))
+			}
+			got, err := a.Authenticate(ctx)
+			if status.Code(err) != tt.wantCode || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate = %+v, %v, want %+v and code %v", got, err, tt.want, tt.wantCode)
+			}
+		})
+	}
+
+	if err := ioutil.WriteFile(path, []byte("lonely-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTokenAuthenticator(path); err == nil {
+		t.Errorf("NewTokenAuthenticator of a line without a subject succeeded")
+	}
+}
+
+func TestHeaderAuthenticator(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "ann", "x-user-roles", "admin, editor,"))
+	got, err := NewHeaderAuthenticator().Authenticate(ctx)
+	if want := (&Identity{Subject: "ann", Roles: []string{"admin", "editor"}}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Authenticate = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := NewHeaderAuthenticator().Authenticate(context.Background()); got != nil || err != nil {
+		t.Errorf("Authenticate without headers = %+v, %v, want an anonymous caller", got, err)
+	}
+}
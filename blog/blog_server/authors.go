@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type authorServer struct {
+	blogpb.UnimplementedAuthorServiceServer
+	store  BlogStore
+	policy Policy
+}
+
+func NewAuthorServer(store BlogStore, policy Policy) *authorServer {
+	return &authorServer{store: store, policy: policy}
+}
+
+func dataToAuthorPb(data *AuthorItem) *blogpb.Author {
+	return &blogpb.Author{
+		Id:          data.ID,
+		DisplayName: data.DisplayName,
+		Bio:         data.Bio,
+		Email:       data.Email,
+		CreatedAt:   timestamppb.New(data.CreatedAt),
+		UpdatedAt:   timestamppb.New(data.UpdatedAt),
+	}
+}
+
+// checkAuthor fails with INVALID_ARGUMENT on field unless the author with
+// the given id exists, so blogs only ever refer to known authors.
+func checkAuthor(ctx context.Context, store BlogStore, field, authorID string) error {
+	_, err := store.GetAuthor(ctx, TenantFromContext(ctx), authorID)
+	if errors.Is(err, ErrAuthorNotFound) {
+		v := &validator{}
+		v.add(field, fmt.Sprintf("names the unknown author %q", authorID))
+		return v.err()
+	}
+	if err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// blogAuthor returns the profile of the author of data for embedding in a
+// response, or nil when the author is not registered.
+func blogAuthor(ctx context.Context, store BlogStore, data *BlogItem) (*blogpb.Author, error) {
+	author, err := store.GetAuthor(ctx, data.Tenant, data.AuthorID)
+	if errors.Is(err, ErrAuthorNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return dataToAuthorPb(author), nil
+}
+
+func (s *authorServer) CreateAuthor(ctx context.Context, req *blogpb.CreateAuthorRequest) (*blogpb.CreateAuthorResponse, error) {
+	fmt.Println("CreateAuthor invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	author := req.GetAuthor()
+	createdAt := now()
+	data := &AuthorItem{
+		ID:          author.GetId(),
+		DisplayName: author.GetDisplayName(),
+		Bio:         author.GetBio(),
+		Email:       author.GetEmail(),
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+	}
+	if err := s.policy.AuthorizeAuthor(ctx, ActionCreate, data); err != nil {
+		return nil, err
+	}
+	created, err := s.store.CreateAuthor(ctx, data)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.CreateAuthorResponse{
+		Author: dataToAuthorPb(created),
+	}, nil
+}
+
+func (s *authorServer) GetAuthor(ctx context.Context, req *blogpb.GetAuthorRequest) (*blogpb.GetAuthorResponse, error) {
+	fmt.Println("GetAuthor invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	author, err := s.store.GetAuthor(ctx, TenantFromContext(ctx), req.GetAuthorId())
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.GetAuthorResponse{
+		Author: dataToAuthorPb(author),
+	}, nil
+}
+
+func (s *authorServer) UpdateAuthor(ctx context.Context, req *blogpb.UpdateAuthorRequest) (*blogpb.UpdateAuthorResponse, error) {
+	fmt.Println("UpdateAuthor invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	author := req.GetAuthor()
+	current, err := s.store.GetAuthor(ctx, TenantFromContext(ctx), author.GetId())
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if err := s.policy.AuthorizeAuthor(ctx, ActionUpdate, current); err != nil {
+		return nil, err
+	}
+
+	update := AuthorUpdate{UpdatedAt: now()}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		for _, f := range authorFields {
+			paths = append(paths, f.path)
+		}
+	}
+	for _, path := range paths {
+		switch path {
+		case "display_name":
+			displayName := author.GetDisplayName()
+			update.DisplayName = &displayName
+		case "bio":
+			bio := author.GetBio()
+			update.Bio = &bio
+		case "email":
+			email := author.GetEmail()
+			update.Email = &email
+		}
+	}
+
+	updated, err := s.store.UpdateAuthor(ctx, TenantFromContext(ctx), author.GetId(), update)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.UpdateAuthorResponse{
+		Author: dataToAuthorPb(updated),
+	}, nil
+}
+
+func (s *authorServer) ListAuthors(ctx context.Context, req *blogpb.ListAuthorsRequest) (*blogpb.ListAuthorsResponse, error) {
+	fmt.Println("ListAuthors invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	// the page token is the id of the last author of the previous page
+	size := pageSize(req.GetPageSize())
+	authors, err := s.store.ListAuthors(ctx, TenantFromContext(ctx), req.GetPageToken(), size+1)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ListAuthorsResponse{}
+	if len(authors) > size {
+		authors = authors[:size]
+		res.NextPageToken = authors[size-1].ID
+	}
+	for i := range authors {
+		res.Authors = append(res.Authors, dataToAuthorPb(&authors[i]))
+	}
+	return res, nil
+}
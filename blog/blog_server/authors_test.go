@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBlogAuthors(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+
+	_, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "nobody", Title: "Title"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateBlog by an unknown author: code %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+
+	blog := mustCreateBlog(t, s, ctx, "ann", "Title")
+	_, err = s.UpdateBlog(ctx, &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: blog.GetId(), AuthorId: "nobody", Title: "Title"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UpdateBlog to an unknown author: code %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestListAuthors(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	authors := NewAuthorServer(s.store, s.policy)
+	ctx := context.Background()
+
+	if _, err := authors.CreateAuthor(ctx, &blogpb.CreateAuthorRequest{Author: &blogpb.Author{Id: "cat", DisplayName: "Cat"}}); err != nil {
+		t.Fatalf("CreateAuthor: %v", err)
+	}
+	if _, err := authors.CreateAuthor(ctx, &blogpb.CreateAuthorRequest{Author: &blogpb.Author{Id: "cat", DisplayName: "Cat"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateAuthor twice: code %v, want %v", status.Code(err), codes.AlreadyExists)
+	}
+
+	var ids []string
+	token := ""
+	for {
+		res, err := authors.ListAuthors(ctx, &blogpb.ListAuthorsRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListAuthors: %v", err)
+		}
+		for _, a := range res.GetAuthors() {
+			ids = append(ids, a.GetId())
+		}
+		if token = res.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	if len(ids) != 3 || ids[0] != "ann" || ids[1] != "bob" || ids[2] != "cat" {
+		t.Errorf("pages list %v, want ann, bob and cat", ids)
+	}
+}
+
+func TestAuthorAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller context.Context
+		want   codes.Code
+	}{
+		{"author edits", callerContext("ann"), codes.OK},
+		{"other edits", callerContext("bob"), codes.PermissionDenied},
+		{"anonymous edits", context.Background(), codes.Unauthenticated},
+		{"admin edits", callerContext("root", "admin"), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+			authors := NewAuthorServer(s.store, s.policy)
+
+			_, err := authors.UpdateAuthor(tt.caller, &blogpb.UpdateAuthorRequest{Author: &blogpb.Author{Id: "ann", DisplayName: "Edited"}})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("UpdateAuthor: code %v (%v), want %v", got, err, tt.want)
+			}
+			read, err := authors.GetAuthor(context.Background(), &blogpb.GetAuthorRequest{AuthorId: "ann"})
+			if edited := read.GetAuthor().GetDisplayName() == "Edited"; err != nil || edited != (tt.want == codes.OK) {
+				t.Errorf("author after UpdateAuthor = %v, %v, want it edited only when allowed", read.GetAuthor(), err)
+			}
+		})
+	}
+
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	authors := NewAuthorServer(s.store, s.policy)
+	create := &blogpb.CreateAuthorRequest{Author: &blogpb.Author{Id: "cat", DisplayName: "Cat"}}
+	if _, err := authors.CreateAuthor(callerContext("bob"), create); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CreateAuthor of another id: error %v, want PERMISSION_DENIED", err)
+	}
+	if _, err := authors.CreateAuthor(callerContext("cat"), create); err != nil {
+		t.Errorf("CreateAuthor of the own id: %v", err)
+	}
+}
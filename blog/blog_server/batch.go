@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxBatchSize caps the number of items of a single batch request.
+	maxBatchSize = 1000
+	// importChunkSize is how many streamed blogs ImportBlogs writes at once.
+	importChunkSize = 500
+)
+
+// batchItemError is returned by an atomic batch, rolled back because of the
+// item at index.
+type batchItemError struct {
+	index int
+	err   error
+}
+
+func (e *batchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.index, e.err)
+}
+
+// checkBatchSize rejects empty and oversized batches.
+func checkBatchSize(n int) error {
+	if n == 0 {
+		return status.Errorf(codes.InvalidArgument, "Batch has no items\n")
+	}
+	if n > maxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "Batch has %d items, the maximum is %d\n", n, maxBatchSize)
+	}
+	return nil
+}
+
+// batchResult reports the outcome of one item, err being a gRPC status error.
+func batchResult(data *BlogItem, err error) *blogpb.BatchBlogResult {
+	if err != nil {
+		return &blogpb.BatchBlogResult{Status: status.Convert(err).Proto()}
+	}
+	return &blogpb.BatchBlogResult{
+		Blog:   dataToBlogPb(data),
+		Status: status.New(codes.OK, "").Proto(),
+	}
+}
+
+// runBatch calls op for n items. In atomic mode all of them run in one
+// transaction that is rolled back by the first failure, which is returned as
+// the error of the whole batch.
+func (s *server) runBatch(ctx context.Context, n int, atomic bool, op func(ctx context.Context, store BlogStore, i int) (*BlogItem, error)) (*blogpb.BatchBlogsResponse, error) {
+	res := &blogpb.BatchBlogsResponse{}
+	if !atomic {
+		for i := 0; i < n; i++ {
+			res.Results = append(res.Results, batchResult(op(ctx, s.store, i)))
+		}
+		return res, nil
+	}
+
+	err := s.store.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+		// a transaction may be retried, so start from scratch every time
+		res.Results = res.Results[:0]
+		for i := 0; i < n; i++ {
+			data, err := op(ctx, tx, i)
+			if err != nil {
+				return &batchItemError{index: i, err: err}
+			}
+			res.Results = append(res.Results, batchResult(data, nil))
+		}
+		return nil
+	})
+	return res, atomicError(err)
+}
+
+// atomicError maps the error of an atomic batch to a gRPC status error that
+// keeps the code of the failing item.
+func atomicError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if itemErr, ok := err.(*batchItemError); ok {
+		st := status.Convert(itemErr.err)
+		return status.Errorf(st.Code(), "Batch rolled back, item %d failed: %v", itemErr.index, st.Message())
+	}
+	return storeError(err)
+}
+
+// bulkBatch is a non-atomic batch of changes to existing blogs written in
+// bulk. Requests it cannot handle in bulk, such as those naming the same blog
+// twice, are run one by one afterwards.
+type bulkBatch struct {
+	results []*blogpb.BatchBlogResult
+	// index, ids and updates describe the writes, index holding the request
+	// index of each
+	index   []int
+	ids     []primitive.ObjectID
+	updates []BlogUpdate
+	// retry holds the request index of those run one by one
+	retry []int
+}
+
+// newBulkBatch parses the id of each valid request of a batch of n and reads
+// the blogs in one go, returning their request indexes along with them.
+func (s *server) newBulkBatch(ctx context.Context, n int, invalid []error, id func(i int) string) (*bulkBatch, []int, []*BlogItem) {
+	b := &bulkBatch{results: make([]*blogpb.BatchBlogResult, n)}
+	var index []int
+	var ids []primitive.ObjectID
+	for i := 0; i < n; i++ {
+		if invalid[i] != nil {
+			b.results[i] = batchResult(nil, invalid[i])
+			continue
+		}
+		oid, err := primitive.ObjectIDFromHex(id(i))
+		if err != nil {
+			b.results[i] = batchResult(nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err))
+			continue
+		}
+		index = append(index, i)
+		ids = append(ids, oid)
+	}
+
+	items, err := s.store.GetMany(ctx, ids)
+	if err != nil {
+		for _, i := range index {
+			b.results[i] = batchResult(nil, storeError(err))
+		}
+		return b, nil, nil
+	}
+
+	// a blog named twice is changed by the first request in bulk and by
+	// the others one by one
+	seen := make(map[primitive.ObjectID]bool)
+	var firsts []int
+	var firstItems []*BlogItem
+	for k, i := range index {
+		if seen[ids[k]] {
+			b.retry = append(b.retry, i)
+			continue
+		}
+		seen[ids[k]] = true
+		firsts = append(firsts, i)
+		firstItems = append(firstItems, items[k])
+	}
+	return b, firsts, firstItems
+}
+
+// write queues update for the blog of request i.
+func (b *bulkBatch) write(i int, current *BlogItem, update BlogUpdate) {
+	b.index = append(b.index, i)
+	b.ids = append(b.ids, current.ID)
+	b.updates = append(b.updates, update)
+}
+
+// run writes the queued updates in one go, then runs the requests left by
+// one, retryable failures of the bulk write included.
+func (b *bulkBatch) run(ctx context.Context, store BlogStore, retryable func(i int, err error) bool, one func(i int) (*BlogItem, error)) *blogpb.BatchBlogsResponse {
+	if len(b.ids) > 0 {
+		updated, errs := store.UpdateMany(ctx, b.ids, b.updates)
+		for k, i := range b.index {
+			switch {
+			case errs[k] == nil:
+				b.results[i] = batchResult(&updated[k], nil)
+			case retryable(i, errs[k]):
+				b.retry = append(b.retry, i)
+			default:
+				b.results[i] = batchResult(nil, storeError(errs[k]))
+			}
+		}
+	}
+	sort.Ints(b.retry)
+	for _, i := range b.retry {
+		b.results[i] = batchResult(one(i))
+	}
+	return &blogpb.BatchBlogsResponse{Results: b.results}
+}
+
+// bulkUpdate runs a non-atomic batch of updates with a few round trips for
+// the whole batch: the blogs are read, their revisions recorded and the
+// updates written in one go each. Creating missing blogs and retrying
+// updates that raced with another writer go through updateBlog.
+func (s *server) bulkUpdate(ctx context.Context, reqs []*blogpb.UpdateBlogRequest, invalid []error) *blogpb.BatchBlogsResponse {
+	b, index, items := s.newBulkBatch(ctx, len(reqs), invalid, func(i int) string {
+		return reqs[i].GetBlog().GetId()
+	})
+	prefix := func(i int) string { return fmt.Sprintf("requests[%d]", i) }
+
+	var left int64
+	if len(index) > 0 {
+		var err error
+		if left, err = s.storageLeft(ctx, s.store); err != nil {
+			for _, i := range append(index, b.retry...) {
+				b.results[i] = batchResult(nil, err)
+			}
+			return &blogpb.BatchBlogsResponse{Results: b.results}
+		}
+	}
+
+	// the authors already found to exist
+	authors := make(map[string]bool)
+	var revs []Revision
+	for k, i := range index {
+		req, current := reqs[i], items[k]
+		if current == nil || current.DeletedAt != nil {
+			if req.GetAllowMissing() {
+				b.retry = append(b.retry, i)
+			} else {
+				b.results[i] = batchResult(nil, storeError(ErrNotFound))
+			}
+			continue
+		}
+
+		err := s.prepareUpdate(ctx, prefix(i), req, current, authors, &left, func(update BlogUpdate) {
+			revs = append(revs, Revision{BlogID: current.ID, Version: current.Version, Blog: *current})
+			b.write(i, current, update)
+		})
+		if err != nil {
+			b.results[i] = batchResult(nil, err)
+		}
+	}
+
+	if err := s.store.AddRevisions(ctx, revs); err != nil {
+		for _, i := range b.index {
+			b.results[i] = batchResult(nil, storeError(err))
+		}
+		b.index, b.ids, b.updates = nil, nil, nil
+	}
+	return b.run(ctx, s.store, func(i int, err error) bool {
+		return errors.Is(err, ErrSlugTaken) || (errors.Is(err, ErrVersionMismatch) && reqs[i].GetExpectedVersion() == 0)
+	}, func(i int) (*BlogItem, error) {
+		return s.updateBlog(ctx, s.store, prefix(i), reqs[i])
+	})
+}
+
+// prepareUpdate runs the checks of updateBlog on the update req makes to
+// current, counting its growth against the bytes left of the tenant, and
+// passes the update to write, made conditional on the version of current.
+func (s *server) prepareUpdate(ctx context.Context, prefix string, req *blogpb.UpdateBlogRequest, current *BlogItem, authors map[string]bool, left *int64, write func(BlogUpdate)) error {
+	blog := req.GetBlog()
+	update, err := blogUpdate(blog, req.GetUpdateMask())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid update mask: %v\n", err)
+	}
+	if err := s.policy.Authorize(ctx, ActionUpdate, current); err != nil {
+		return err
+	}
+	next, err := s.authorizeChange(ctx, current, update)
+	if err != nil {
+		return err
+	}
+	if update.AuthorID != nil && !authors[*update.AuthorID] {
+		if err := checkAuthor(ctx, s.store, fieldPath(prefix, "blog.author_id"), *update.AuthorID); err != nil {
+			return err
+		}
+		authors[*update.AuthorID] = true
+	}
+	if v := req.GetExpectedVersion(); v != 0 && v != current.Version {
+		return storeError(ErrVersionMismatch)
+	}
+	if grow := next.size() - current.size(); *left >= 0 && grow > 0 {
+		if grow > *left {
+			quota := s.quotas.forTenant(TenantFromContext(ctx))
+			return status.Errorf(codes.ResourceExhausted, "Quota exceeded: %d bytes requested, %d left of %d\n", grow, *left, quota.MaxBytes)
+		}
+		*left -= grow
+	}
+
+	update.UpdatedAt = now()
+	update.IfVersion = current.Version
+	// a new title gets a new slug, or one the blog had before
+	if update.Title != nil && *update.Title != current.Title {
+		slug, err := uniqueSlug(ctx, s.store, slugify(*update.Title), current.ID, nil)
+		if err != nil {
+			return storeError(err)
+		}
+		update.Slug = &slug
+	}
+	write(update)
+	return nil
+}
+
+// bulkDelete moves the blogs of a non-atomic batch to the trash with a few
+// round trips for the whole batch, like bulkUpdate.
+func (s *server) bulkDelete(ctx context.Context, reqs []*blogpb.DeleteBlogRequest, invalid []error) *blogpb.BatchBlogsResponse {
+	b, index, items := s.newBulkBatch(ctx, len(reqs), invalid, func(i int) string {
+		return reqs[i].GetBlogId()
+	})
+
+	deleted := true
+	for k, i := range index {
+		current := items[k]
+		if current == nil || current.DeletedAt != nil {
+			b.results[i] = batchResult(nil, storeError(ErrNotFound))
+			continue
+		}
+		if err := s.policy.Authorize(ctx, ActionDelete, current); err != nil {
+			b.results[i] = batchResult(nil, err)
+			continue
+		}
+		if v := reqs[i].GetExpectedVersion(); v != 0 && v != current.Version {
+			b.results[i] = batchResult(nil, storeError(ErrVersionMismatch))
+			continue
+		}
+		b.write(i, current, BlogUpdate{Deleted: &deleted, UpdatedAt: now(), IfVersion: current.Version})
+	}
+
+	return b.run(ctx, s.store, func(i int, err error) bool {
+		return errors.Is(err, ErrVersionMismatch) && reqs[i].GetExpectedVersion() == 0
+	}, func(i int) (*BlogItem, error) {
+		return s.deleteBlog(ctx, s.store, reqs[i])
+	})
+}
+
+func (s *server) BatchCreateBlogs(ctx context.Context, req *blogpb.BatchCreateBlogsRequest) (*blogpb.BatchBlogsResponse, error) {
+	fmt.Println("BatchCreateBlogs invoked")
+
+	blogs := req.GetBlogs()
+	if err := checkBatchSize(len(blogs)); err != nil {
+		return nil, err
+	}
+
+	invalid, err := validateBatch(len(blogs), req.GetAtomic(), func(v *validator, i int) {
+		v.blog(fmt.Sprintf("blogs[%d]", i), blogs[i], nil)
+		v.optionalID(fmt.Sprintf("blogs[%d].id", i), blogs[i].GetId())
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, blog := range blogs {
+		if invalid[i] != nil {
+			continue
+		}
+		err := checkAuthor(ctx, s.store, fmt.Sprintf("blogs[%d].author_id", i), blog.GetAuthorId())
+		if err == nil {
+			item := newBlogItem(blog)
+			err = s.policy.Authorize(ctx, ActionCreate, &item)
+		}
+		if err != nil {
+			if req.GetAtomic() {
+				return nil, err
+			}
+			invalid[i] = err
+		}
+	}
+
+	// valid holds the request index of each of items
+	var valid []int
+	var size int64
+	items := make([]BlogItem, 0, len(blogs))
+	for i, blog := range blogs {
+		if invalid[i] == nil {
+			item := newBlogItem(blog)
+			if blog.GetId() != "" {
+				// a blog keeps the id it comes with, validated above
+				item.ID, _ = primitive.ObjectIDFromHex(blog.GetId())
+			}
+			valid = append(valid, i)
+			items = append(items, item)
+			size += item.size()
+		}
+	}
+	// the quota is checked for the batch as a whole
+	if err := s.checkQuota(ctx, s.store, int64(len(items)), size); err != nil {
+		return nil, err
+	}
+
+	res := &blogpb.BatchBlogsResponse{}
+	if !req.GetAtomic() {
+		res.Results = make([]*blogpb.BatchBlogResult, len(blogs))
+		for i, err := range invalid {
+			if err != nil {
+				res.Results[i] = batchResult(nil, err)
+			}
+		}
+		if len(items) == 0 {
+			return res, nil
+		}
+
+		if err := assignSlugs(ctx, s.store, items); err != nil {
+			return nil, storeError(err)
+		}
+		created, errs := s.store.CreateMany(ctx, items)
+		for j := range created {
+			if errs[j] != nil {
+				res.Results[valid[j]] = batchResult(nil, storeError(errs[j]))
+				continue
+			}
+			res.Results[valid[j]] = batchResult(&created[j], nil)
+		}
+		return res, nil
+	}
+
+	err = s.store.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+		res.Results = res.Results[:0]
+		if err := assignSlugs(ctx, tx, items); err != nil {
+			return err
+		}
+		created, errs := tx.CreateMany(ctx, items)
+		for i := range created {
+			if errs[i] != nil {
+				return &batchItemError{index: i, err: storeError(errs[i])}
+			}
+			res.Results = append(res.Results, batchResult(&created[i], nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, atomicError(err)
+	}
+	return res, nil
+}
+
+func (s *server) BatchUpdateBlogs(ctx context.Context, req *blogpb.BatchUpdateBlogsRequest) (*blogpb.BatchBlogsResponse, error) {
+	fmt.Println("BatchUpdateBlogs invoked")
+
+	reqs := req.GetRequests()
+	if err := checkBatchSize(len(reqs)); err != nil {
+		return nil, err
+	}
+
+	invalid, err := validateBatch(len(reqs), req.GetAtomic(), func(v *validator, i int) {
+		v.updateRequest(fmt.Sprintf("requests[%d]", i), reqs[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.GetAtomic() {
+		return s.bulkUpdate(ctx, reqs, invalid), nil
+	}
+	res, err := s.runBatch(ctx, len(reqs), true, func(ctx context.Context, store BlogStore, i int) (*BlogItem, error) {
+		if invalid[i] != nil {
+			return nil, invalid[i]
+		}
+		return s.updateBlog(ctx, store, fmt.Sprintf("requests[%d]", i), reqs[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *server) BatchDeleteBlogs(ctx context.Context, req *blogpb.BatchDeleteBlogsRequest) (*blogpb.BatchBlogsResponse, error) {
+	fmt.Println("BatchDeleteBlogs invoked")
+
+	reqs := req.GetRequests()
+	if err := checkBatchSize(len(reqs)); err != nil {
+		return nil, err
+	}
+
+	invalid, err := validateBatch(len(reqs), req.GetAtomic(), func(v *validator, i int) {
+		v.deleteRequest(fmt.Sprintf("requests[%d]", i), reqs[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.GetAtomic() {
+		return s.bulkDelete(ctx, reqs, invalid), nil
+	}
+	res, err := s.runBatch(ctx, len(reqs), true, func(ctx context.Context, store BlogStore, i int) (*BlogItem, error) {
+		if invalid[i] != nil {
+			return nil, invalid[i]
+		}
+		return s.deleteBlog(ctx, store, reqs[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *server) ImportBlogs(stream blogpb.BlogService_ImportBlogsServer) error {
+	fmt.Println("ImportBlogs invoked")
+
+	res := &blogpb.ImportBlogsResponse{}
+	fail := func(index int64, err error) {
+		if res.Failures == nil {
+			res.Failures = make(map[int64]*spb.Status)
+		}
+		res.Failures[index] = status.Convert(err).Proto()
+	}
+
+	items := make([]BlogItem, 0, importChunkSize)
+	// indexes holds the stream index of each of items
+	indexes := make([]int64, 0, importChunkSize)
+	flush := func() error {
+		var size int64
+		for i := range items {
+			size += items[i].size()
+		}
+		if err := s.checkQuota(stream.Context(), s.store, int64(len(items)), size); err != nil {
+			// the whole chunk fails, the following ones may still fit
+			for _, index := range indexes {
+				fail(index, err)
+			}
+			items, indexes = items[:0], indexes[:0]
+			return nil
+		}
+		if err := assignSlugs(stream.Context(), s.store, items); err != nil {
+			return storeError(err)
+		}
+		_, errs := s.store.CreateMany(stream.Context(), items)
+		for i, err := range errs {
+			if err != nil {
+				fail(indexes[i], storeError(err))
+				continue
+			}
+			res.CreatedCount++
+		}
+		items, indexes = items[:0], indexes[:0]
+		return nil
+	}
+
+	for index := int64(0); ; index++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := validateBlog("blog", req.GetBlog()); err != nil {
+			fail(index, err)
+			continue
+		}
+		if err := checkAuthor(stream.Context(), s.store, "blog.author_id", req.GetBlog().GetAuthorId()); err != nil {
+			fail(index, err)
+			continue
+		}
+		item := newBlogItem(req.GetBlog())
+		if err := s.policy.Authorize(stream.Context(), ActionCreate, &item); err != nil {
+			fail(index, err)
+			continue
+		}
+		items = append(items, item)
+		indexes = append(indexes, index)
+		if len(items) == importChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(items) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	return stream.SendAndClose(res)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// resultCodes returns the status code of every result of a batch.
+func resultCodes(res *blogpb.BatchBlogsResponse) []codes.Code {
+	got := make([]codes.Code, len(res.GetResults()))
+	for i, r := range res.GetResults() {
+		got[i] = codes.Code(r.GetStatus().GetCode())
+	}
+	return got
+}
+
+func checkCodes(t *testing.T, res *blogpb.BatchBlogsResponse, want []codes.Code) {
+	t.Helper()
+	got := resultCodes(res)
+	if len(got) != len(want) {
+		t.Fatalf("batch has %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result %d: code %v (%q), want %v", i, got[i], res.GetResults()[i].GetStatus().GetMessage(), want[i])
+		}
+	}
+}
+
+func TestBatchCreateBlogs(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+
+	res, err := s.BatchCreateBlogs(ctx, &blogpb.BatchCreateBlogsRequest{Blogs: []*blogpb.Blog{
+		{AuthorId: "ann", Title: "One"},
+		{AuthorId: "ann", Title: "Two"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateBlogs: %v", err)
+	}
+	checkCodes(t, res, []codes.Code{codes.OK, codes.OK})
+	for i, r := range res.GetResults() {
+		read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: r.GetBlog().GetId()})
+		if err != nil || read.GetBlog().GetVersion() != 1 {
+			t.Errorf("created blog %d = %v, %v, want it stored at version 1", i, read.GetBlog(), err)
+		}
+	}
+
+	if _, err := s.BatchCreateBlogs(ctx, &blogpb.BatchCreateBlogsRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("empty batch: error %v, want INVALID_ARGUMENT", err)
+	}
+}
+
+func TestBatchCreateBlogsWithIDs(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+	taken := mustCreateBlog(t, s, ctx, "ann", "Taken")
+	preset := primitive.NewObjectID().Hex()
+
+	res, err := s.BatchCreateBlogs(ctx, &blogpb.BatchCreateBlogsRequest{Blogs: []*blogpb.Blog{
+		{Id: preset, AuthorId: "ann", Title: "Preset"},
+		{Id: taken.GetId(), AuthorId: "ann", Title: "Clash"},
+		{Id: "not an id", AuthorId: "ann", Title: "Invalid"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateBlogs: %v", err)
+	}
+	checkCodes(t, res, []codes.Code{codes.OK, codes.AlreadyExists, codes.InvalidArgument})
+	if got := res.GetResults()[0].GetBlog().GetId(); got != preset {
+		t.Errorf("blog with an id was created under %q, want %q", got, preset)
+	}
+	read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: taken.GetId()})
+	if err != nil || read.GetBlog().GetTitle() != "Taken" {
+		t.Errorf("blog whose id was reused = %v, %v, want it unchanged", read.GetBlog(), err)
+	}
+}
+
+func TestBatchUpdateBlogs(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	ctx := callerContext("ann")
+	one := mustCreateBlog(t, s, ctx, "ann", "One")
+	two := mustCreateBlog(t, s, ctx, "ann", "Two")
+	bobs := mustCreateBlog(t, s, callerContext("bob"), "bob", "Bob")
+	missing := primitive.NewObjectID().Hex()
+
+	update := func(id, title string) *blogpb.UpdateBlogRequest {
+		return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: id, AuthorId: "ann", Title: title}}
+	}
+	res, err := s.BatchUpdateBlogs(ctx, &blogpb.BatchUpdateBlogsRequest{Requests: []*blogpb.UpdateBlogRequest{
+		update(one.GetId(), "Same"),
+		update(two.GetId(), "Same"),
+		// a second update of a blog applies after the first
+		update(one.GetId(), "Again"),
+		update(missing, "Missing"),
+		{AllowMissing: true, Blog: &blogpb.Blog{Id: missing, AuthorId: "ann", Title: "Upserted"}},
+		{ExpectedVersion: 7, Blog: &blogpb.Blog{Id: two.GetId(), AuthorId: "ann", Title: "Stale"}},
+		update(bobs.GetId(), "Stolen"),
+		update("not an id", "Invalid"),
+	}})
+	if err != nil {
+		t.Fatalf("BatchUpdateBlogs: %v", err)
+	}
+	checkCodes(t, res, []codes.Code{
+		codes.OK, codes.OK, codes.OK, codes.NotFound, codes.OK, codes.Aborted, codes.PermissionDenied, codes.InvalidArgument,
+	})
+
+	results := res.GetResults()
+	if b := results[0].GetBlog(); b.GetSlug() != "same" || b.GetVersion() != 2 {
+		t.Errorf("first update = slug %q version %d, want same and 2", b.GetSlug(), b.GetVersion())
+	}
+	if b := results[1].GetBlog(); b.GetSlug() != "same-2" {
+		t.Errorf("colliding title got the slug %q, want same-2", b.GetSlug())
+	}
+	if b := results[2].GetBlog(); b.GetTitle() != "Again" || b.GetVersion() != 3 {
+		t.Errorf("repeated update = title %q version %d, want Again and 3", b.GetTitle(), b.GetVersion())
+	}
+	if b := results[4].GetBlog(); b.GetId() != missing || b.GetVersion() != 1 {
+		t.Errorf("allow_missing created id %q version %d, want %q and 1", b.GetId(), b.GetVersion(), missing)
+	}
+
+	revs, err := s.ListBlogRevisions(ctx, &blogpb.ListBlogRevisionsRequest{BlogId: one.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(revs.GetRevisions()); n != 2 {
+		t.Errorf("blog updated twice has %d revisions, want 2", n)
+	}
+	read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: bobs.GetId()})
+	if err != nil || read.GetBlog().GetTitle() != "Bob" {
+		t.Errorf("blog of another author = %v, %v, want it unchanged", read.GetBlog(), err)
+	}
+}
+
+func TestBatchUpdateBlogsAtomic(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+	blog := mustCreateBlog(t, s, ctx, "ann", "Original")
+
+	_, err := s.BatchUpdateBlogs(ctx, &blogpb.BatchUpdateBlogsRequest{Atomic: true, Requests: []*blogpb.UpdateBlogRequest{
+		{Blog: &blogpb.Blog{Id: blog.GetId(), AuthorId: "ann", Title: "Changed"}},
+		{Blog: &blogpb.Blog{Id: primitive.NewObjectID().Hex(), AuthorId: "ann", Title: "Missing"}},
+	}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("atomic batch with a missing blog: error %v, want NOT_FOUND", err)
+	}
+	read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: blog.GetId()})
+	if err != nil || read.GetBlog().GetTitle() != "Original" || read.GetBlog().GetVersion() != 1 {
+		t.Errorf("blog after a failed atomic batch = %v, %v, want it unchanged", read.GetBlog(), err)
+	}
+}
+
+func TestBatchDeleteBlogs(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	ctx := callerContext("ann")
+	one := mustCreateBlog(t, s, ctx, "ann", "One")
+	two := mustCreateBlog(t, s, ctx, "ann", "Two")
+	bobs := mustCreateBlog(t, s, callerContext("bob"), "bob", "Bob")
+
+	res, err := s.BatchDeleteBlogs(ctx, &blogpb.BatchDeleteBlogsRequest{Requests: []*blogpb.DeleteBlogRequest{
+		{BlogId: one.GetId()},
+		// the blog is in the trash by then
+		{BlogId: one.GetId()},
+		{BlogId: two.GetId(), ExpectedVersion: 9},
+		{BlogId: bobs.GetId()},
+		{BlogId: primitive.NewObjectID().Hex()},
+	}})
+	if err != nil {
+		t.Fatalf("BatchDeleteBlogs: %v", err)
+	}
+	checkCodes(t, res, []codes.Code{codes.OK, codes.NotFound, codes.Aborted, codes.PermissionDenied, codes.NotFound})
+	if b := res.GetResults()[0].GetBlog(); b.GetDeletedAt() == nil || b.GetVersion() != 2 {
+		t.Errorf("deleted blog = %v, want it in the trash at version 2", b)
+	}
+
+	if _, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: two.GetId()}); err != nil {
+		t.Errorf("blog with a stale expected version: %v, want it left alone", err)
+	}
+}
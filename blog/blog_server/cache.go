@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// Cache keeps encoded values for a while. Implementations must be safe for
+// concurrent use and may drop values at any time.
+type Cache interface {
+	// Get returns the value stored under key, unless it expired.
+	Get(key string) ([]byte, bool)
+	// Set stores value under key for ttl, or until it is evicted.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete drops the value stored under key, if any.
+	Delete(key string)
+	// Clear drops every value.
+	Clear()
+	// Stats returns the counters of the cache since it was created.
+	Stats() CacheStats
+}
+
+// CacheStats counts how a Cache was used.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	// Evictions counts the values dropped to make room for others.
+	Evictions int64
+	// Entries is the number of values currently held.
+	Entries int
+}
+
+// HitRate returns the share of lookups that found a value, 0 before the
+// first one.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
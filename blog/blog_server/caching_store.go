@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cachingStore reads blogs and bounded listings through a Cache, dropping
+// what a write may have changed. Changes made by other servers sharing the
+// database are only seen once the cached values expire.
+type cachingStore struct {
+	BlogStore
+	cache   Cache
+	ttl     time.Duration
+	listTTL time.Duration
+	// generation counts the writes. It is part of the key of listings, so
+	// a write retires them all, and lets a read drop what it cached when a
+	// write went through meanwhile.
+	generation int64
+}
+
+// NewCachingStore returns a BlogStore caching the blogs read from store in
+// cache for ttl and its listings for listTTL.
+func NewCachingStore(store BlogStore, cache Cache, ttl, listTTL time.Duration) BlogStore {
+	return &cachingStore{BlogStore: store, cache: cache, ttl: ttl, listTTL: listTTL}
+}
+
+func blogCacheKey(id primitive.ObjectID) string {
+	return "blog:" + id.Hex()
+}
+
+// cachedList is a cached listing.
+type cachedList struct {
+	Items []BlogItem
+}
+
+func encodeCached(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeCached(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// fill caches value under key unless a write went through since the
+// generation gen was read, as value may predate it.
+func (s *cachingStore) fill(gen int64, key string, value interface{}, ttl time.Duration) {
+	data, err := encodeCached(value)
+	if err != nil {
+		return
+	}
+	s.cache.Set(key, data, ttl)
+	// A write bumping the generation after this check drops key itself.
+	if atomic.LoadInt64(&s.generation) != gen {
+		s.cache.Delete(key)
+	}
+}
+
+// retireLists retires the cached listings, once a write is done.
+func (s *cachingStore) retireLists() {
+	atomic.AddInt64(&s.generation, 1)
+}
+
+// invalidate retires the listings and drops the cached blog with the given
+// id, once a write to it is done.
+func (s *cachingStore) invalidate(id primitive.ObjectID) {
+	s.retireLists()
+	s.cache.Delete(blogCacheKey(id))
+}
+
+// invalidateAll drops every cached value, after a write to blogs whose ids
+// are not known.
+func (s *cachingStore) invalidateAll() {
+	s.retireLists()
+	s.cache.Clear()
+}
+
+func (s *cachingStore) Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error) {
+	key := blogCacheKey(id)
+	if data, ok := s.cache.Get(key); ok {
+		var item BlogItem
+		if err := decodeCached(data, &item); err == nil {
+			return &item, nil
+		}
+	}
+
+	gen := atomic.LoadInt64(&s.generation)
+	item, err := s.BlogStore.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.fill(gen, key, item, s.ttl)
+	return item, nil
+}
+
+// List caches bounded listings only, those going through every blog being
+// left to the store.
+func (s *cachingStore) List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error {
+	if opts.Limit == 0 {
+		return s.BlogStore.List(ctx, opts, fn)
+	}
+	gen := atomic.LoadInt64(&s.generation)
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return s.BlogStore.List(ctx, opts, fn)
+	}
+	key := fmt.Sprintf("list:%d:%s", gen, encoded)
+
+	if data, ok := s.cache.Get(key); ok {
+		var list cachedList
+		if err := decodeCached(data, &list); err == nil {
+			for i := range list.Items {
+				if err := fn(&list.Items[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	var list cachedList
+	err = s.BlogStore.List(ctx, opts, func(item *BlogItem) error {
+		list.Items = append(list.Items, *item)
+		return fn(item)
+	})
+	if err != nil {
+		return err
+	}
+	s.fill(gen, key, list, s.listTTL)
+	return nil
+}
+
+func (s *cachingStore) Create(ctx context.Context, item *BlogItem) (*BlogItem, error) {
+	defer s.retireLists()
+	return s.BlogStore.Create(ctx, item)
+}
+
+func (s *cachingStore) CreateMany(ctx context.Context, items []BlogItem) ([]BlogItem, []error) {
+	defer s.retireLists()
+	return s.BlogStore.CreateMany(ctx, items)
+}
+
+func (s *cachingStore) Replace(ctx context.Context, item *BlogItem) error {
+	defer s.invalidate(item.ID)
+	return s.BlogStore.Replace(ctx, item)
+}
+
+func (s *cachingStore) Update(ctx context.Context, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error) {
+	defer s.invalidate(id)
+	return s.BlogStore.Update(ctx, id, u)
+}
+
+func (s *cachingStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, updates []BlogUpdate) ([]BlogItem, []error) {
+	defer func() {
+		for _, id := range ids {
+			s.invalidate(id)
+		}
+	}()
+	return s.BlogStore.UpdateMany(ctx, ids, updates)
+}
+
+func (s *cachingStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int64) error {
+	defer s.invalidate(id)
+	return s.BlogStore.Delete(ctx, id, ifVersion)
+}
+
+func (s *cachingStore) Purge(ctx context.Context, deletedBefore time.Time) ([]BlogItem, error) {
+	purged, err := s.BlogStore.Purge(ctx, deletedBefore)
+	if len(purged) > 0 {
+		s.invalidateAll()
+	}
+	return purged, err
+}
+
+func (s *cachingStore) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	n, err := s.BlogStore.PublishDue(ctx, now)
+	if n > 0 {
+		s.invalidateAll()
+	}
+	return n, err
+}
+
+// Atomically runs fn against the store itself, uncommitted blogs staying out
+// of the cache, and drops the whole cache once it is done.
+func (s *cachingStore) Atomically(ctx context.Context, fn func(ctx context.Context, tx BlogStore) error) error {
+	defer s.invalidateAll()
+	return s.BlogStore.Atomically(ctx, fn)
+}
+
+// reportCacheStats logs the counters of cache every interval until ctx is
+// done.
+func reportCacheStats(ctx context.Context, cache Cache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats := cache.Stats()
+		log.Printf("Cache: %d hits, %d misses (%.1f%% hit rate), %d evictions, %d entries\n",
+			stats.Hits, stats.Misses, 100*stats.HitRate(), stats.Evictions, stats.Entries)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingStore counts the reads reaching a BlogStore.
+type countingStore struct {
+	BlogStore
+	gets, lists int
+}
+
+func (s *countingStore) Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error) {
+	s.gets++
+	return s.BlogStore.Get(ctx, id)
+}
+
+func (s *countingStore) List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error {
+	s.lists++
+	return s.BlogStore.List(ctx, opts, fn)
+}
+
+func newTestCachingStore(t *testing.T) (BlogStore, *countingStore) {
+	t.Helper()
+	counting := &countingStore{BlogStore: NewMemoryStore()}
+	return NewCachingStore(counting, NewLRUCache(100), time.Minute, time.Minute), counting
+}
+
+func TestCachingStoreGet(t *testing.T) {
+	ctx := context.Background()
+	store, counting := newTestCachingStore(t)
+	id := seedBlogs(t, store, "original")[0]
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counting.gets != 1 {
+		t.Errorf("two reads of a blog reached the store %d times, want once", counting.gets)
+	}
+
+	title := "updated"
+	if _, err := store.Update(ctx, id, BlogUpdate{Title: &title}); err != nil {
+		t.Fatal(err)
+	}
+	item, err := store.Get(ctx, id)
+	if err != nil || item.Title != title {
+		t.Errorf("read after an update = %v, %v, want the title %q", item, err, title)
+	}
+	if counting.gets != 2 {
+		t.Errorf("read after an update reached the store %d times in all, want twice", counting.gets)
+	}
+
+	if _, err := store.Get(ctx, primitive.NewObjectID()); err == nil {
+		t.Errorf("read of a missing blog succeeded")
+	}
+}
+
+func TestCachingStoreList(t *testing.T) {
+	ctx := context.Background()
+	store, counting := newTestCachingStore(t)
+	ids := seedBlogs(t, store, "a", "b")
+	page := ListOptions{Limit: 10}
+
+	listIDs(t, store, page)
+	if got := listIDs(t, store, page); len(got) != 2 || counting.lists != 1 {
+		t.Errorf("second listing = %v after %d store listings, want 2 blogs after 1", got, counting.lists)
+	}
+
+	// every listing goes to the store
+	listIDs(t, store, ListOptions{})
+	if counting.lists != 2 {
+		t.Errorf("unbounded listing: %d store listings in all, want 2", counting.lists)
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+		want  int
+	}{
+		{"create", func() error {
+			_, err := store.Create(ctx, &BlogItem{Title: "c"})
+			return err
+		}, 3},
+		{"trash", func() error {
+			yes := true
+			_, err := store.Update(ctx, ids[0], BlogUpdate{Deleted: &yes})
+			return err
+		}, 2},
+		{"transaction", func() error {
+			return store.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+				_, err := tx.Create(ctx, &BlogItem{Title: "d"})
+				return err
+			})
+		}, 3},
+	}
+	for _, w := range writes {
+		before := counting.lists
+		if err := w.write(); err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		if got := listIDs(t, store, page); len(got) != w.want {
+			t.Errorf("listing after a %s has %d blogs, want %d", w.name, len(got), w.want)
+		}
+		if counting.lists != before+1 {
+			t.Errorf("listing after a %s was served from the cache", w.name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type commentServer struct {
+	blogpb.UnimplementedCommentServiceServer
+	store  BlogStore
+	policy Policy
+}
+
+func NewCommentServer(store BlogStore, policy Policy) *commentServer {
+	return &commentServer{store: store, policy: policy}
+}
+
+func dataToCommentPb(data *CommentItem) *blogpb.Comment {
+	comment := &blogpb.Comment{
+		Id:        data.ID.Hex(),
+		BlogId:    data.BlogID.Hex(),
+		AuthorId:  data.AuthorID,
+		Content:   data.Content,
+		CreatedAt: timestamppb.New(data.CreatedAt),
+	}
+	if !data.ParentID.IsZero() {
+		comment.ParentId = data.ParentID.Hex()
+	}
+	return comment
+}
+
+// liveComment returns the comment with the given id and its blog, unless the
+// blog is gone or in the trash.
+func (s *commentServer) liveComment(ctx context.Context, id primitive.ObjectID) (*CommentItem, *BlogItem, error) {
+	c, err := s.store.GetComment(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	blog, err := readableBlog(ctx, s.store, s.policy, c.BlogID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, blog, nil
+}
+
+func (s *commentServer) AddComment(ctx context.Context, req *blogpb.AddCommentRequest) (*blogpb.AddCommentResponse, error) {
+	fmt.Println("AddComment invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	comment := req.GetComment()
+	blogID, err := primitive.ObjectIDFromHex(comment.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse blog id: %v.\n", err)
+	}
+	blog, err := readableBlog(ctx, s.store, s.policy, blogID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	data := &CommentItem{
+		BlogID:    blogID,
+		AuthorID:  comment.GetAuthorId(),
+		Content:   comment.GetContent(),
+		CreatedAt: now(),
+	}
+	if err := s.policy.AuthorizeComment(ctx, ActionCreate, data, blog); err != nil {
+		return nil, err
+	}
+	if err := checkAuthor(ctx, s.store, "comment.author_id", data.AuthorID); err != nil {
+		return nil, err
+	}
+	if comment.GetParentId() != "" {
+		parentID, err := primitive.ObjectIDFromHex(comment.GetParentId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Cannot parse parent id: %v.\n", err)
+		}
+		parent, err := s.store.GetComment(ctx, parentID)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if parent.BlogID != blogID {
+			return nil, status.Errorf(codes.InvalidArgument, "Parent comment belongs to another blog\n")
+		}
+		data.ParentID = parentID
+		data.Ancestors = append(append([]primitive.ObjectID(nil), parent.Ancestors...), parentID)
+	}
+
+	created, err := s.store.AddComment(ctx, data)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.AddCommentResponse{
+		Comment: dataToCommentPb(created),
+	}, nil
+}
+
+func (s *commentServer) ListComments(ctx context.Context, req *blogpb.ListCommentsRequest) (*blogpb.ListCommentsResponse, error) {
+	fmt.Println("ListComments invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	blogID, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse blog id: %v.\n", err)
+	}
+
+	var parentID *primitive.ObjectID
+	if req.GetParentId() != "" {
+		oid, err := primitive.ObjectIDFromHex(req.GetParentId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Cannot parse parent id: %v.\n", err)
+		}
+		parentID = &oid
+	}
+
+	// the page token is the id of the last comment of the previous page
+	var after primitive.ObjectID
+	if req.GetPageToken() != "" {
+		after, err = primitive.ObjectIDFromHex(req.GetPageToken())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid page token: %q\n", req.GetPageToken())
+		}
+	}
+
+	if _, err := readableBlog(ctx, s.store, s.policy, blogID); err != nil {
+		return nil, storeError(err)
+	}
+
+	size := pageSize(req.GetPageSize())
+	comments, err := s.store.ListComments(ctx, blogID, parentID, after, size+1)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ListCommentsResponse{}
+	if len(comments) > size {
+		comments = comments[:size]
+		res.NextPageToken = comments[size-1].ID.Hex()
+	}
+	for i := range comments {
+		res.Comments = append(res.Comments, dataToCommentPb(&comments[i]))
+	}
+	return res, nil
+}
+
+func (s *commentServer) DeleteComment(ctx context.Context, req *blogpb.DeleteCommentRequest) (*blogpb.DeleteCommentResponse, error) {
+	fmt.Println("DeleteComment invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetCommentId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	comment, blog, err := s.liveComment(ctx, oid)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if err := s.policy.AuthorizeComment(ctx, ActionDelete, comment, blog); err != nil {
+		return nil, err
+	}
+	deleted, err := s.store.DeleteComment(ctx, oid)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.DeleteCommentResponse{
+		CommentId:    oid.Hex(),
+		DeletedCount: deleted,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAddComment(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	comments := NewCommentServer(s.store, s.policy)
+	ctx := context.Background()
+	blog := mustCreateBlog(t, s, ctx, "ann", "Blog")
+	other := mustCreateBlog(t, s, ctx, "ann", "Other")
+	parent, err := comments.AddComment(ctx, &blogpb.AddCommentRequest{
+		Comment: &blogpb.Comment{BlogId: other.GetId(), AuthorId: "bob", Content: "hi"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		comment *blogpb.Comment
+		want    codes.Code
+	}{
+		{"comment", &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "bob", Content: "hi"}, codes.OK},
+		{"no content", &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "bob"}, codes.InvalidArgument},
+		{"bad blog id", &blogpb.Comment{BlogId: "x", AuthorId: "bob", Content: "hi"}, codes.InvalidArgument},
+		{"parent on another blog", &blogpb.Comment{BlogId: blog.GetId(), ParentId: parent.GetComment().GetId(), AuthorId: "bob", Content: "hi"}, codes.InvalidArgument},
+		{"no comment", nil, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := comments.AddComment(ctx, &blogpb.AddCommentRequest{Comment: tt.comment})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("AddComment: code %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	comments := NewCommentServer(s.store, s.policy)
+	ctx := context.Background()
+	blog := mustCreateBlog(t, s, ctx, "ann", "Blog")
+	add := func(parentID string) string {
+		t.Helper()
+		added, err := comments.AddComment(ctx, &blogpb.AddCommentRequest{
+			Comment: &blogpb.Comment{BlogId: blog.GetId(), ParentId: parentID, AuthorId: "bob", Content: "hi"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return added.GetComment().GetId()
+	}
+	top := add("")
+	add(add(top))
+
+	res, err := comments.DeleteComment(ctx, &blogpb.DeleteCommentRequest{CommentId: top})
+	if err != nil || res.GetDeletedCount() != 3 {
+		t.Errorf("DeleteComment of a thread = %v, %v, want 3 comments deleted", res, err)
+	}
+	listed, err := comments.ListComments(ctx, &blogpb.ListCommentsRequest{BlogId: blog.GetId()})
+	if err != nil || len(listed.GetComments()) != 0 {
+		t.Errorf("ListComments after deleting the thread = %v, %v, want none", listed.GetComments(), err)
+	}
+	if _, err := comments.DeleteComment(ctx, &blogpb.DeleteCommentRequest{CommentId: top}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteComment twice: code %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
+func TestAddCommentAuthorization(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	comments := NewCommentServer(s.store, s.policy)
+	blog := mustCreateBlog(t, s, callerContext("ann"), "ann", "Blog")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		comment *blogpb.Comment
+		want    codes.Code
+	}{
+		{"own name", callerContext("bob"), &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "bob", Content: "hi"}, codes.OK},
+		{"anonymous", context.Background(), &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "bob", Content: "hi"}, codes.Unauthenticated},
+		{"another name", callerContext("bob"), &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "ann", Content: "hi"}, codes.PermissionDenied},
+		{"admin for an unknown author", callerContext("root", "admin"), &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "nobody", Content: "hi"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := comments.AddComment(tt.ctx, &blogpb.AddCommentRequest{Comment: tt.comment})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("AddComment: code %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteCommentAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller context.Context
+		want   codes.Code
+	}{
+		{"comment author", callerContext("bob"), codes.OK},
+		{"blog owner", callerContext("ann"), codes.OK},
+		{"admin", callerContext("root", "admin"), codes.OK},
+		{"someone else", callerContext("cat"), codes.PermissionDenied},
+		{"anonymous", context.Background(), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+			comments := NewCommentServer(s.store, s.policy)
+			blog := mustCreateBlog(t, s, callerContext("ann"), "ann", "Blog")
+			added, err := comments.AddComment(callerContext("bob"), &blogpb.AddCommentRequest{
+				Comment: &blogpb.Comment{BlogId: blog.GetId(), AuthorId: "bob", Content: "hi"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = comments.DeleteComment(tt.caller, &blogpb.DeleteCommentRequest{CommentId: added.GetComment().GetId()})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("DeleteComment: code %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type dirAttachmentStore struct {
+	dir string
+}
+
+// NewDirAttachmentStore returns an AttachmentStore keeping every attachment
+// in the directory dir as two files named after its id: the content, and
+// its description encoded as BSON.
+func NewDirAttachmentStore(dir string) (AttachmentStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirAttachmentStore{dir: dir}, nil
+}
+
+func (s *dirAttachmentStore) contentPath(id primitive.ObjectID) string {
+	return filepath.Join(s.dir, id.Hex())
+}
+
+func (s *dirAttachmentStore) infoPath(id primitive.ObjectID) string {
+	return filepath.Join(s.dir, id.Hex()+".bson")
+}
+
+// writeFile writes the file at path through a temporary file and an atomic
+// rename, as the file store does.
+func (s *dirAttachmentStore) writeFile(path string, r io.Reader) error {
+	tmp, err := ioutil.TempFile(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *dirAttachmentStore) Put(ctx context.Context, item *AttachmentItem, r io.Reader) (*AttachmentItem, error) {
+	content := newChecksumReader(r)
+	if err := s.writeFile(s.contentPath(item.ID), content); err != nil {
+		return nil, err
+	}
+
+	// the description is written last so Get only finds complete uploads
+	stored := *item
+	stored.Size, stored.SHA256 = content.size, content.sum()
+	raw, err := bson.Marshal(&stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeFile(s.infoPath(item.ID), bytes.NewReader(raw)); err != nil {
+		os.Remove(s.contentPath(item.ID))
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (s *dirAttachmentStore) Get(ctx context.Context, id primitive.ObjectID) (*AttachmentItem, error) {
+	raw, err := ioutil.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item := &AttachmentItem{}
+	if err := bson.Unmarshal(raw, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *dirAttachmentStore) Open(ctx context.Context, id primitive.ObjectID) (io.ReadCloser, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.contentPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAttachmentNotFound
+	}
+	return f, err
+}
+
+// Usage reads the description of every attachment, which is fine for the
+// small deployments this store is meant for.
+func (s *dirAttachmentStore) Usage(ctx context.Context, tenant string) (int64, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.bson"))
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		var item AttachmentItem
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return 0, err
+		}
+		if item.Tenant == tenant {
+			total += item.Size
+		}
+	}
+	return total, nil
+}
+
+func (s *dirAttachmentStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	// removing the description first hides the attachment right away
+	err := os.Remove(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrAttachmentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(s.contentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
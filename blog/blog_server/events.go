@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// eventHistorySize is how many past events an eventBus keeps for watchers
+// that resume or fall behind.
+const eventHistorySize = 1024
+
+// eventBus fans blog events out to the watchers of an in-process store.
+type eventBus struct {
+	mu sync.Mutex
+	// id tells tokens of this process apart from those of a previous run
+	id string
+	// seq is the sequence number of the last published event
+	seq uint64
+	// history holds the latest events, the oldest first
+	history []BlogEvent
+	// changed is closed and replaced on every publish to wake up watchers
+	changed chan struct{}
+}
+
+func newEventBus() *eventBus {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return &eventBus{
+		id:      hex.EncodeToString(id),
+		changed: make(chan struct{}),
+	}
+}
+
+// newBlogEvent returns an event about item, which only carries the id and
+// the tenant of the blog for EventPurged.
+func newBlogEvent(typ EventType, item *BlogItem) BlogEvent {
+	ev := BlogEvent{Type: typ, BlogID: item.ID, Tenant: item.Tenant}
+	if typ != EventPurged {
+		copied := *item
+		ev.Blog = &copied
+	}
+	return ev
+}
+
+// publish records ev under the next resume token.
+func (b *eventBus) publish(ev BlogEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	ev.ResumeToken = b.id + ":" + strconv.FormatUint(b.seq, 10)
+
+	if len(b.history) == eventHistorySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, ev)
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// start returns the sequence number a watch resuming after token begins at.
+func (b *eventBus) start(token string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if token == "" {
+		return b.seq + 1, nil
+	}
+
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return 0, ErrInvalidResumeToken
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResumeToken
+	}
+	if parts[0] != b.id || seq > b.seq {
+		return 0, ErrResumeTokenExpired
+	}
+	return seq + 1, nil
+}
+
+// since returns the events from sequence number next on, and a channel
+// closed once more are published.
+func (b *eventBus) since(next uint64) ([]BlogEvent, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.seq + 1 - uint64(len(b.history))
+	if next < oldest {
+		return nil, nil, ErrResumeTokenExpired
+	}
+	events := make([]BlogEvent, b.seq+1-next)
+	copy(events, b.history[next-oldest:])
+	return events, b.changed, nil
+}
+
+// watch calls fn for every event matching opts until ctx is done or fn
+// fails.
+func (b *eventBus) watch(ctx context.Context, opts WatchOptions, fn func(*BlogEvent) error) error {
+	next, err := b.start(opts.ResumeToken)
+	if err != nil {
+		return err
+	}
+
+	for {
+		events, changed, err := b.since(next)
+		if err != nil {
+			return fmt.Errorf("watcher fell behind: %w", err)
+		}
+		for i := range events {
+			next++
+			if !opts.matches(&events[i]) {
+				continue
+			}
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
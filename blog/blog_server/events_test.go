@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// watchEvents collects the types of the first n events store streams for
+// opts.
+func watchEvents(t *testing.T, store BlogStore, opts WatchOptions, n int) []EventType {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errDone := errors.New("done")
+	var types []EventType
+	err := store.Watch(ctx, opts, func(ev *BlogEvent) error {
+		types = append(types, ev.Type)
+		if len(types) == n {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Watch: %v", err)
+	}
+	return types
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	start := store.events.id + ":0"
+	yes := true
+
+	ann, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(ctx, &BlogItem{AuthorID: "bob", Title: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Update(ctx, ann.ID, BlogUpdate{Deleted: &yes, UpdatedAt: now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Purge(ctx, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EventType{EventCreated, EventCreated, EventDeleted, EventPurged}
+	if got := watchEvents(t, store, WatchOptions{ResumeToken: start}, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	want = []EventType{EventCreated, EventDeleted, EventPurged}
+	if got := watchEvents(t, store, WatchOptions{AuthorID: "ann", ResumeToken: start}, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("events of ann = %v, want %v", got, want)
+	}
+
+	// a watch without a token only sees what happens next
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "c"})
+	}()
+	if got := watchEvents(t, store, WatchOptions{}, 1); got[0] != EventCreated {
+		t.Errorf("live event = %v, want created", got[0])
+	}
+
+	for token, wantErr := range map[string]error{
+		"garbage":                  ErrInvalidResumeToken,
+		store.events.id + ":x":     ErrInvalidResumeToken,
+		"0badc0de:1":               ErrResumeTokenExpired,
+		store.events.id + ":99999": ErrResumeTokenExpired,
+	} {
+		err := store.Watch(ctx, WatchOptions{ResumeToken: token}, func(*BlogEvent) error { return nil })
+		if !errors.Is(err, wantErr) {
+			t.Errorf("Watch from %q: error = %v, want %v", token, err, wantErr)
+		}
+	}
+}
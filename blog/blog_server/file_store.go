@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fileData is the on-disk layout of a file store, encoded as a single BSON
+// document so BlogItem keeps the same field names it has in MongoDB.
+type fileData struct {
+	Blogs     []BlogItem    `bson:"blogs"`
+	Revisions []Revision    `bson:"revisions"`
+	Comments  []CommentItem `bson:"comments"`
+	Authors   []fileAuthor  `bson:"authors"`
+}
+
+// fileAuthor is an AuthorItem as stored in the file. Files written before
+// authors had tenants hold their id in LegacyID.
+type fileAuthor struct {
+	AuthorItem `bson:",inline"`
+	LegacyID   string `bson:"_id,omitempty"`
+}
+
+// NewFileStore returns a BlogStore persisted to the single file at path.
+// Blogs are served from memory and every mutation rewrites the file through
+// a temporary file and an atomic rename, so a crash leaves either the old or
+// the new contents on disk, never a partial write.
+func NewFileStore(path string) (BlogStore, error) {
+	s := newMemoryStore()
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		var data fileData
+		if err := bson.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %w", path, err)
+		}
+		for i := range data.Blogs {
+			item := &data.Blogs[i]
+			item.CreatedAt, item.UpdatedAt = item.timestamps()
+			s.put(item.ID, item)
+		}
+		for _, rev := range data.Revisions {
+			s.revisions[rev.BlogID] = append(s.revisions[rev.BlogID], rev)
+		}
+		for _, c := range data.Comments {
+			s.comments[c.ID] = c
+		}
+		for _, a := range data.Authors {
+			if a.ID == "" {
+				a.ID = a.LegacyID
+			}
+			s.authors[authorKey{a.Tenant, a.ID}] = a.AuthorItem
+		}
+	}
+
+	s.persist = func(s *memoryStore) error {
+		data := fileData{Blogs: make([]BlogItem, 0, len(s.items))}
+		for _, item := range s.items {
+			data.Blogs = append(data.Blogs, item)
+		}
+		for _, revs := range s.revisions {
+			data.Revisions = append(data.Revisions, revs...)
+		}
+		for _, c := range s.comments {
+			data.Comments = append(data.Comments, c)
+		}
+		for _, a := range s.authors {
+			data.Authors = append(data.Authors, fileAuthor{AuthorItem: a})
+		}
+		raw, err := bson.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path, raw)
+	}
+	return s, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "blogs.bson")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "Kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "Deleted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, deleted.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if got, err := reopened.Get(ctx, kept.ID); err != nil || got.Title != "Kept" {
+		t.Errorf("Get after reopening = %+v, %v, want the stored blog", got, err)
+	}
+	if _, err := reopened.Get(ctx, deleted.ID); err == nil {
+		t.Errorf("deleted blog is back after reopening")
+	}
+
+	// no temporary file is left next to the store
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory of the store holds %d files, want 1", len(entries))
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blogs.bson")
+	if err := ioutil.WriteFile(path, []byte("not bson"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Errorf("NewFileStore of a corrupt file succeeded")
+	}
+}
+
+func TestFileStoreAuthors(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "blogs.bson")
+	// authors were keyed by their _id before they had tenants
+	raw, err := bson.Marshal(bson.M{"authors": bson.A{bson.M{"_id": "ann", "display_name": "Ann"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateAuthor(ctx, &AuthorItem{ID: "ann", Tenant: "other", DisplayName: "Other Ann"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	for tenant, want := range map[string]string{"": "Ann", "other": "Other Ann"} {
+		if got, err := reopened.GetAuthor(ctx, tenant, "ann"); err != nil || got.DisplayName != want {
+			t.Errorf("GetAuthor of tenant %q after reopening = %+v, %v, want %q", tenant, got, err, want)
+		}
+	}
+}
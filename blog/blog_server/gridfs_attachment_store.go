@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attachmentBucket is the GridFS bucket holding the attachments, stored in
+// the attachments.files and attachments.chunks collections.
+const attachmentBucket = "attachments"
+
+type gridFSAttachmentStore struct {
+	bucket *gridfs.Bucket
+	files  *mongo.Collection
+}
+
+// gridFSFile is a document of the files collection of the bucket, the
+// fields GridFS does not know about being kept in its metadata.
+type gridFSFile struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Length     int64              `bson:"length"`
+	UploadDate time.Time          `bson:"uploadDate"`
+	Filename   string             `bson:"filename"`
+	Metadata   gridFSMetadata     `bson:"metadata"`
+}
+
+type gridFSMetadata struct {
+	BlogID      primitive.ObjectID `bson:"blog_id,omitempty"`
+	ContentType string             `bson:"content_type"`
+	// SHA256 is written once the content is complete, so files without it
+	// are still being uploaded or were abandoned.
+	SHA256 string `bson:"sha256,omitempty"`
+	Tenant string `bson:"tenant,omitempty"`
+}
+
+// NewGridFSAttachmentStore returns an AttachmentStore keeping attachments in
+// a GridFS bucket of the given MongoDB database.
+func NewGridFSAttachmentStore(db *mongo.Database) (AttachmentStore, error) {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(attachmentBucket))
+	if err != nil {
+		return nil, err
+	}
+	return &gridFSAttachmentStore{
+		bucket: bucket,
+		files:  bucket.GetFilesCollection(),
+	}, nil
+}
+
+func (s *gridFSAttachmentStore) Put(ctx context.Context, item *AttachmentItem, r io.Reader) (*AttachmentItem, error) {
+	meta := gridFSMetadata{BlogID: item.BlogID, ContentType: item.ContentType, Tenant: item.Tenant}
+	upload, err := s.bucket.OpenUploadStreamWithID(item.ID, item.Filename, options.GridFSUpload().SetMetadata(meta))
+	if err != nil {
+		return nil, err
+	}
+	// GridFS streams take deadlines rather than contexts
+	if deadline, ok := ctx.Deadline(); ok {
+		upload.SetWriteDeadline(deadline)
+	}
+
+	content := newChecksumReader(r)
+	if _, err := io.Copy(upload, content); err != nil {
+		upload.Abort()
+		return nil, err
+	}
+	if err := upload.Close(); err != nil {
+		return nil, err
+	}
+
+	_, err = s.files.UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{"$set": bson.M{"metadata.sha256": content.sum()}})
+	if err != nil {
+		s.bucket.Delete(item.ID)
+		return nil, err
+	}
+	return s.Get(ctx, item.ID)
+}
+
+func (s *gridFSAttachmentStore) Get(ctx context.Context, id primitive.ObjectID) (*AttachmentItem, error) {
+	var file gridFSFile
+	err := s.files.FindOne(ctx, bson.M{"_id": id, "metadata.sha256": bson.M{"$exists": true}}).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttachmentItem{
+		ID:          file.ID,
+		BlogID:      file.Metadata.BlogID,
+		Filename:    file.Filename,
+		ContentType: file.Metadata.ContentType,
+		Size:        file.Length,
+		SHA256:      file.Metadata.SHA256,
+		CreatedAt:   file.UploadDate,
+		Tenant:      file.Metadata.Tenant,
+	}, nil
+}
+
+func (s *gridFSAttachmentStore) Open(ctx context.Context, id primitive.ObjectID) (io.ReadCloser, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	download, err := s.bucket.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		download.SetReadDeadline(deadline)
+	}
+	return download, nil
+}
+
+func (s *gridFSAttachmentStore) Usage(ctx context.Context, tenant string) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"metadata.tenant": tenantValue(tenant),
+			"metadata.sha256": bson.M{"$exists": true},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "bytes": bson.M{"$sum": "$length"}}}},
+	}
+
+	cur, err := s.files.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var usage []struct {
+		Bytes int64 `bson:"bytes"`
+	}
+	if err := cur.All(ctx, &usage); err != nil {
+		return 0, err
+	}
+	if len(usage) == 0 {
+		return 0, nil
+	}
+	return usage[0].Bytes, nil
+}
+
+func (s *gridFSAttachmentStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	err := s.bucket.Delete(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return ErrAttachmentNotFound
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", []byte("1"), time.Minute)
+	cache.Set("b", []byte("2"), time.Minute)
+	// a becomes the most recently used
+	if v, ok := cache.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v, want 1", v, ok)
+	}
+	cache.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("least recently used value was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get(%s) missed after an eviction", key)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats = %+v, want 3 hits, 1 miss, 1 eviction and 2 entries", stats)
+	}
+	if rate := stats.HitRate(); rate != 0.75 {
+		t.Errorf("HitRate = %v, want 0.75", rate)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	cache := NewLRUCache(10)
+	cache.Set("gone", []byte("1"), -time.Second)
+	cache.Set("kept", []byte("2"), time.Minute)
+
+	if _, ok := cache.Get("gone"); ok {
+		t.Errorf("expired value was returned")
+	}
+	if _, ok := cache.Get("kept"); !ok {
+		t.Errorf("live value was not returned")
+	}
+	if n := cache.Stats().Entries; n != 1 {
+		t.Errorf("cache holds %d entries after an expiry, want 1", n)
+	}
+
+	cache.Delete("kept")
+	cache.Set("x", []byte("3"), time.Minute)
+	cache.Clear()
+	if n := cache.Stats().Entries; n != 0 {
+		t.Errorf("cache holds %d entries after Clear, want 0", n)
+	}
+}
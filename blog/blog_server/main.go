@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
@@ -18,18 +19,151 @@ import (
 func main() {
 	// if we crash the go code, we get the file name and line number
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	fmt.Println("Connecting to MongoDB...")
 
-	// connect to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
+	storeKind := flag.String("store", "mongo", "storage backend: mongo, file or memory")
+	mongoURI := flag.String("mongo-uri", "mongodb://localhost:27017", "MongoDB connection string")
+	dbFile := flag.String("db-file", "blog.db", "data file used by the file backend")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted blogs stay in the trash, 0 keeps them forever")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "how often the trash is purged")
+	publishInterval := flag.Duration("publish-interval", 10*time.Second, "how often scheduled blogs are checked for publishing")
+	attachmentStoreKind := flag.String("attachment-store", "", "attachment backend: gridfs or dir, gridfs with the mongo store and dir otherwise when empty")
+	attachmentDir := flag.String("attachment-dir", "attachments", "directory used by the dir attachment backend")
+	maxAttachmentSize := flag.Int64("max-attachment-size", 10<<20, "largest attachment accepted, in bytes")
+	authKind := flag.String("auth", "", "caller authentication: token or header, none when empty")
+	authTokens := flag.String("auth-tokens", "tokens.txt", "file of the bearer tokens accepted by the token authentication")
+	adminRole := flag.String("admin-role", "admin", "role allowed to change the blogs and profiles of every author")
+	tenantMaxBlogs := flag.Int64("tenant-max-blogs", 0, "most blogs a tenant may store, 0 for no limit")
+	tenantMaxBytes := flag.Int64("tenant-max-bytes", 0, "most bytes of blogs and attachments a tenant may store, 0 for no limit")
+	tenantQuotas := flag.String("tenant-quotas", "", "file of per-tenant quotas overriding the two flags above")
+	maxListRate := flag.Float64("max-list-rate", 0, "most blogs per second a ListBlog call streams, 0 for no limit")
+	cacheKind := flag.String("cache", "", "cache of the blogs read: lru, none when empty")
+	cacheSize := flag.Int("cache-size", 10000, "most blogs and listings kept by the lru cache")
+	cacheTTL := flag.Duration("cache-ttl", time.Minute, "how long a blog stays cached")
+	cacheListTTL := flag.Duration("cache-list-ttl", 10*time.Second, "how long a listing stays cached")
+	cacheStatsInterval := flag.Duration("cache-stats-interval", 5*time.Minute, "how often the cache counters are logged, 0 never logs them")
+	flag.Parse()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		log.Fatal(err)
+	var store BlogStore
+	var client *mongo.Client
+	var db *mongo.Database
+
+	switch *storeKind {
+	case "mongo":
+		fmt.Println("Connecting to MongoDB...")
+
+		// connect to MongoDB
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		var err error
+		client, err = mongo.Connect(ctx, options.Client().ApplyURI(*mongoURI))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		db = client.Database("mydb")
+		if err := BackfillTimestamps(ctx, db); err != nil {
+			log.Fatalf("Cannot backfill blog timestamps: %v\n", err)
+		}
+		if err := EnsureIndexes(ctx, db); err != nil {
+			log.Fatalf("Cannot create the indexes: %v\n", err)
+		}
+		store = NewMongoStore(db)
+	case "file":
+		fmt.Printf("Using file storage at %s...\n", *dbFile)
+		var err error
+		store, err = NewFileStore(*dbFile)
+		if err != nil {
+			log.Fatalf("Cannot open data file: %v\n", err)
+		}
+	case "memory":
+		fmt.Println("Using in-memory storage...")
+		store = NewMemoryStore()
+	default:
+		log.Fatalf("Unknown store %q\n", *storeKind)
+	}
+
+	var cache Cache
+	switch *cacheKind {
+	case "lru":
+		if *cacheSize <= 0 {
+			log.Fatalf("The lru cache needs a positive size\n")
+		}
+		fmt.Printf("Caching up to %d blogs and listings...\n", *cacheSize)
+		cache = NewLRUCache(*cacheSize)
+		store = NewCachingStore(store, cache, *cacheTTL, *cacheListTTL)
+	case "":
+	default:
+		log.Fatalf("Unknown cache %q\n", *cacheKind)
+	}
+
+	if *attachmentStoreKind == "" {
+		*attachmentStoreKind = "dir"
+		if db != nil {
+			*attachmentStoreKind = "gridfs"
+		}
+	}
+	var attachments AttachmentStore
+	switch *attachmentStoreKind {
+	case "gridfs":
+		if db == nil {
+			log.Fatalf("The gridfs attachment store needs the mongo store\n")
+		}
+		var err error
+		attachments, err = NewGridFSAttachmentStore(db)
+		if err != nil {
+			log.Fatalf("Cannot open the attachment bucket: %v\n", err)
+		}
+	case "dir":
+		fmt.Printf("Storing attachments in %s...\n", *attachmentDir)
+		var err error
+		attachments, err = NewDirAttachmentStore(*attachmentDir)
+		if err != nil {
+			log.Fatalf("Cannot create the attachment directory: %v\n", err)
+		}
+	default:
+		log.Fatalf("Unknown attachment store %q\n", *attachmentStoreKind)
+	}
+
+	var authenticator Authenticator
+	switch *authKind {
+	case "token":
+		var err error
+		authenticator, err = NewTokenAuthenticator(*authTokens)
+		if err != nil {
+			log.Fatalf("Cannot read the tokens: %v\n", err)
+		}
+	case "header":
+		authenticator = NewHeaderAuthenticator()
+	case "":
+		fmt.Println("Authentication is off, anyone can change any blog")
+	default:
+		log.Fatalf("Unknown authentication %q\n", *authKind)
+	}
+	policy := NewAllowAllPolicy()
+	var unary []grpc.UnaryServerInterceptor
+	var streams []grpc.StreamServerInterceptor
+	if authenticator != nil {
+		policy = NewOwnerPolicy(*adminRole)
+		unary = append(unary, AuthUnaryInterceptor(authenticator))
+		streams = append(streams, AuthStreamInterceptor(authenticator))
+	}
+	// without authentication the tenant header is all there is to go by
+	unary = append(unary, TenantUnaryInterceptor(authenticator == nil))
+	streams = append(streams, TenantStreamInterceptor(authenticator == nil))
+
+	quotas := Quotas{Default: Quota{MaxBlogs: *tenantMaxBlogs, MaxBytes: *tenantMaxBytes}}
+	if *tenantQuotas != "" {
+		var err error
+		quotas, err = LoadQuotas(*tenantQuotas, quotas.Default)
+		if err != nil {
+			log.Fatalf("Cannot read the quotas: %v\n", err)
+		}
 	}
 
-	Collection = client.Database("mydb").Collection("blog")
+	if err := backfillSlugs(context.Background(), store); err != nil {
+		log.Fatalf("Cannot backfill blog slugs: %v\n", err)
+	}
 
 	fmt.Println("Blog Service started...")
 
@@ -38,13 +172,31 @@ func main() {
 		log.Fatalf("Failed to listen: %v\n", err)
 	}
 
-	server := NewServer()
+	// requests only ever see the blogs of their tenant
+	scoped := NewTenantStore(store)
+	server := NewServer(scoped, attachments, *maxAttachmentSize, policy, quotas, *maxListRate)
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
 
-	s := grpc.NewServer()
+	if *trashRetention > 0 {
+		go purgeTrash(bgCtx, store, attachments, *trashRetention, *purgeInterval)
+	}
+	go publishScheduled(bgCtx, store, *publishInterval)
+	if cache != nil && *cacheStatsInterval > 0 {
+		go reportCacheStats(bgCtx, cache, *cacheStatsInterval)
+	}
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(streams...),
+	)
 	blogpb.RegisterBlogServiceServer(s, server)
+	blogpb.RegisterCommentServiceServer(s, NewCommentServer(scoped, policy))
+	blogpb.RegisterAuthorServiceServer(s, NewAuthorServer(scoped, policy))
 
 	go func() {
-		fmt.Println("Starting Server...\n")
+		fmt.Println("Starting Server...")
 		if err := s.Serve(lis); err != nil {
 			log.Fatalf("Failed to serve: %v\n", err)
 		}
@@ -57,10 +209,13 @@ func main() {
 	// Block until signal is received
 	<-ch
 	fmt.Println("Stopping the server...")
+	stopBackground()
 	s.Stop()
 	fmt.Println("Stopping the listener...")
 	lis.Close()
-	fmt.Println("Closing MongoDB connection")
-	client.Disconnect(context.TODO())
+	if client != nil {
+		fmt.Println("Closing MongoDB connection")
+		client.Disconnect(context.TODO())
+	}
 	fmt.Println("\nEnd of the program...")
 }
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// markdownToHTML renders the common subset of Markdown: ATX headings,
+// paragraphs, block quotes, nested lists, fenced and indented code,
+// thematic breaks, emphasis, code spans, links, images, autolinks and hard
+// line breaks. Raw HTML is shown as text rather than passed through, and
+// the output still has to go through sanitizeHTML, which checks the URLs.
+func markdownToHTML(src string) string {
+	src = strings.ReplaceAll(strings.ReplaceAll(src, "\r\n", "\n"), "\t", "    ")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"), false)
+	return b.String()
+}
+
+var (
+	atxHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))??(?:[ \t]+#+)?[ \t]*$`)
+	thematic     = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	codeFence    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`]*)$")
+	bulletItem   = regexp.MustCompile(`^( {0,3})([-*+])( +|$)`)
+	orderedItem  = regexp.MustCompile(`^( {0,3})([0-9]{1,9})([.)])( +|$)`)
+	emailAddress = regexp.MustCompile(`^[A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+$`)
+)
+
+// listMarker describes the marker starting a list item.
+type listMarker struct {
+	ordered bool
+	// delim is the bullet character or the punctuation after the number
+	delim byte
+	start int
+	// width is the column the content of the item starts at
+	width int
+}
+
+func parseListMarker(line string) (listMarker, bool) {
+	if m := bulletItem.FindStringSubmatch(line); m != nil {
+		return listMarker{delim: m[2][0], width: itemWidth(m[0], m[3])}, true
+	}
+	if m := orderedItem.FindStringSubmatch(line); m != nil {
+		start, _ := strconv.Atoi(m[2])
+		return listMarker{ordered: true, delim: m[3][0], start: start, width: itemWidth(m[0], m[4])}, true
+	}
+	return listMarker{}, false
+}
+
+// itemWidth returns the content column of a list item whose marker and
+// following spaces are marker. Content starting with 5 or more spaces is
+// indented code, only the first one belonging to the marker.
+func itemWidth(marker, spaces string) int {
+	if len(spaces) == 0 || len(spaces) > 4 {
+		return len(marker) - len(spaces) + 1
+	}
+	return len(marker)
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock reports whether line interrupts a paragraph.
+func startsBlock(line string) bool {
+	if atxHeading.MatchString(line) || thematic.MatchString(line) || codeFence.MatchString(line) {
+		return true
+	}
+	if strings.HasPrefix(strings.TrimLeft(line, " "), ">") {
+		return true
+	}
+	m, ok := parseListMarker(line)
+	// an empty item or a list not starting at 1 would turn many sentences
+	// into lists
+	return ok && len(line) > m.width && (!m.ordered || m.start == 1)
+}
+
+// renderBlocks writes the blocks of lines. In tight lists the paragraphs
+// are not wrapped in <p>.
+func renderBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case codeFence.MatchString(line):
+			m := codeFence.FindStringSubmatch(line)
+			fence, indent := m[1], indentation(line)
+			var code []string
+			for i++; i < len(lines); i++ {
+				trimmed := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+					i++
+					break
+				}
+				// the indentation of the fence is removed from the code
+				n := indentation(lines[i])
+				if n > indent {
+					n = indent
+				}
+				code = append(code, lines[i][n:])
+			}
+			b.WriteString("<pre><code")
+			if info := strings.Fields(m[2]); len(info) > 0 {
+				b.WriteString(` class="language-` + html.EscapeString(info[0]) + `"`)
+			}
+			b.WriteString(">")
+			if len(code) > 0 {
+				b.WriteString(html.EscapeString(strings.Join(code, "\n") + "\n"))
+			}
+			b.WriteString("</code></pre>\n")
+
+		case indentation(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (isBlank(lines[i]) || indentation(lines[i]) >= 4); i++ {
+				if isBlank(lines[i]) {
+					code = append(code, "")
+					continue
+				}
+				code = append(code, lines[i][4:])
+			}
+			for len(code) > 0 && code[len(code)-1] == "" {
+				code = code[:len(code)-1]
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")+"\n") + "</code></pre>\n")
+
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			tag := "h" + strconv.Itoa(len(m[1]))
+			b.WriteString("<" + tag + ">")
+			renderInline(b, strings.TrimSpace(m[2]))
+			b.WriteString("</" + tag + ">\n")
+			i++
+
+		case thematic.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			var quoted []string
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+				l := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(l, ">") {
+					// a lazy continuation of the quoted paragraph
+					if startsBlock(lines[i]) {
+						break
+					}
+					quoted = append(quoted, l)
+					continue
+				}
+				l = strings.TrimPrefix(l[1:], " ")
+				quoted = append(quoted, l)
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, false)
+			b.WriteString("</blockquote>\n")
+
+		default:
+			if m, ok := parseListMarker(line); ok {
+				i = renderList(b, lines, i, m)
+				continue
+			}
+
+			var para []string
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+				if len(para) > 0 && startsBlock(lines[i]) {
+					break
+				}
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			text := strings.TrimRight(strings.Join(para, "\n"), " ")
+			if tight {
+				renderInline(b, text)
+				b.WriteString("\n")
+				continue
+			}
+			b.WriteString("<p>")
+			renderInline(b, text)
+			b.WriteString("</p>\n")
+		}
+	}
+}
+
+// renderList writes the list starting with the item at lines[i], whose
+// marker is first, and returns the index of the line after it.
+func renderList(b *strings.Builder, lines []string, i int, first listMarker) int {
+	var items [][]string
+	var item []string
+	width := first.width
+	loose := false
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m, ok := parseListMarker(line); ok && indentation(line) < width {
+			if m.ordered != first.ordered || m.delim != first.delim || thematic.MatchString(line) {
+				break
+			}
+			if item != nil {
+				if isBlank(item[len(item)-1]) {
+					loose = true
+				}
+				items = append(items, item)
+			}
+			width = m.width
+			item = []string{""}
+			if len(line) > width {
+				item[0] = line[width:]
+			}
+			continue
+		}
+
+		switch {
+		case isBlank(line):
+			item = append(item, "")
+			continue
+		case indentation(line) >= width:
+			item = append(item, line[width:])
+			continue
+		case !isBlank(item[len(item)-1]) && !startsBlock(line):
+			// a lazy continuation of the last paragraph of the item
+			item = append(item, line)
+			continue
+		}
+		break
+	}
+	items = append(items, item)
+
+	// blank lines between the blocks of an item make the list loose too,
+	// those ending the list do not count
+	for n, it := range items {
+		for len(it) > 0 && isBlank(it[len(it)-1]) {
+			it = it[:len(it)-1]
+			if n < len(items)-1 {
+				loose = true
+			}
+		}
+		items[n] = it
+		for _, l := range it {
+			if isBlank(l) {
+				loose = true
+			}
+		}
+	}
+	// the blank lines after the list are not part of it
+	for i > 0 && isBlank(lines[i-1]) {
+		i--
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, it := range items {
+		b.WriteString("<li>")
+		renderBlocks(b, it, !loose)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// isPunct reports whether a backslash can escape c.
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// runLength returns how many times s[i] repeats from i on.
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// renderInline writes the inline content s.
+func renderInline(b *strings.Builder, s string) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && isPunct(s[i+1]) {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\n' {
+				b.WriteString("<br>\n")
+				i += 2
+				continue
+			}
+
+		case ' ':
+			n := runLength(s, i)
+			if i+n < len(s) && s[i+n] == '\n' {
+				// spaces ending a line are dropped, two of them or more
+				// make a hard break
+				if n >= 2 {
+					b.WriteString("<br>")
+				}
+				i += n
+				continue
+			}
+
+		case '`':
+			n := runLength(s, i)
+			if end := closingBackticks(s, i+n, n); end >= 0 {
+				code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end + n
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				if text, dest, title, end, ok := parseLink(s, i+1); ok {
+					b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(plainText(text)) + `"`)
+					if title != "" {
+						b.WriteString(` title="` + html.EscapeString(title) + `"`)
+					}
+					b.WriteString(">")
+					i = end
+					continue
+				}
+			}
+
+		case '[':
+			if text, dest, title, end, ok := parseLink(s, i); ok {
+				b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">")
+				renderInline(b, text)
+				b.WriteString("</a>")
+				i = end
+				continue
+			}
+
+		case '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				target := s[i+1 : i+end]
+				dest := ""
+				switch {
+				case strings.ContainsAny(target, " <\n"):
+				case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"), strings.HasPrefix(target, "mailto:"):
+					dest = target
+				case emailAddress.MatchString(target):
+					dest = "mailto:" + target
+				}
+				if dest != "" {
+					b.WriteString(`<a href="` + html.EscapeString(dest) + `">` + html.EscapeString(target) + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+
+		case '*', '_', '~':
+			if end, ok := renderEmphasis(b, s, i); ok {
+				i = end
+				continue
+			}
+			n := runLength(s, i)
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+}
+
+// closingBackticks returns the index of the next run of exactly n backticks
+// in s from i on, or -1.
+func closingBackticks(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		j += i
+		run := runLength(s, j)
+		if run == n {
+			return j
+		}
+		i = j + run
+	}
+	return -1
+}
+
+// renderEmphasis writes the emphasis opened by the delimiter run at s[i]
+// and returns the index after its closing run. A run closes an opening one
+// of the same length: one "*" or "_" for <em>, two for <strong>, three for
+// both, and two "~" for <del>.
+func renderEmphasis(b *strings.Builder, s string, i int) (int, bool) {
+	c, n := s[i], runLength(s, i)
+	if n > 3 || (c == '~' && n != 2) {
+		return 0, false
+	}
+	// the opening run must be followed by text, and "_" must not be inside
+	// a word so snake_case names stay as they are
+	if i+n >= len(s) || isSpace(s[i+n]) || (c == '_' && i > 0 && isAlnum(s[i-1])) {
+		return 0, false
+	}
+
+	for j := i + n; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			run := runLength(s, j)
+			if end := closingBackticks(s, j+run, run); end >= 0 {
+				j = end + run
+				continue
+			}
+			j += run
+			continue
+		case '[':
+			if _, _, _, end, ok := parseLink(s, j); ok {
+				j = end
+				continue
+			}
+		case c:
+			run := runLength(s, j)
+			closes := run == n && !isSpace(s[j-1]) &&
+				!(c == '_' && j+run < len(s) && isAlnum(s[j+run]))
+			if !closes {
+				j += run
+				continue
+			}
+
+			open, close := "", ""
+			switch {
+			case c == '~':
+				open, close = "<del>", "</del>"
+			case n == 1:
+				open, close = "<em>", "</em>"
+			case n == 2:
+				open, close = "<strong>", "</strong>"
+			default:
+				open, close = "<em><strong>", "</strong></em>"
+			}
+			b.WriteString(open)
+			renderInline(b, s[i+n:j])
+			b.WriteString(close)
+			return j + run, true
+		}
+		j++
+	}
+	return 0, false
+}
+
+// parseLink parses the link starting with the "[" at s[i], as in
+// [text](destination "title"), and returns the index after it.
+func parseLink(s string, i int) (text, dest, title string, end int, ok bool) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j+1 >= len(s) || s[j] != ']' || s[j+1] != '(' {
+		return "", "", "", 0, false
+	}
+	text = s[i+1 : j]
+
+	k := j + 2
+	skipSpaces := func() {
+		for k < len(s) && isSpace(s[k]) {
+			k++
+		}
+	}
+	skipSpaces()
+	if k < len(s) && s[k] == '<' {
+		close := strings.IndexAny(s[k:], ">\n")
+		if close < 0 || s[k+close] != '>' {
+			return "", "", "", 0, false
+		}
+		dest = s[k+1 : k+close]
+		k += close + 1
+	} else {
+		start, parens := k, 0
+		for ; k < len(s) && !isSpace(s[k]); k++ {
+			if s[k] == '(' {
+				parens++
+			} else if s[k] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		dest = s[start:k]
+	}
+	skipSpaces()
+	if k < len(s) && (s[k] == '"' || s[k] == '\'') {
+		close := strings.IndexByte(s[k+1:], s[k])
+		if close < 0 {
+			return "", "", "", 0, false
+		}
+		title = s[k+1 : k+1+close]
+		k += close + 2
+		skipSpaces()
+	}
+	if k >= len(s) || s[k] != ')' {
+		return "", "", "", 0, false
+	}
+	return text, unescapeMarkdown(dest), unescapeMarkdown(title), k + 1, true
+}
+
+// unescapeMarkdown removes the backslashes escaping punctuation in s.
+func unescapeMarkdown(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// plainText returns the text of the inline content s without its markup,
+// for image descriptions.
+func plainText(s string) string {
+	var b strings.Builder
+	renderInline(&b, s)
+	_, text := sanitizeHTML(b.String())
+	return text
+}
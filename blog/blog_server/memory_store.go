@@ -0,0 +1,849 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	items map[primitive.ObjectID]BlogItem
+	index *invertedIndex
+	// slugs maps every current and former slug to its blog.
+	slugs map[slugKey]primitive.ObjectID
+	// revisions holds the revisions of each blog ordered by version.
+	revisions map[primitive.ObjectID][]Revision
+	comments  map[primitive.ObjectID]CommentItem
+	authors   map[authorKey]AuthorItem
+	events    *eventBus
+	// pending collects the events of a transaction instead of publishing
+	// them, see Atomically.
+	pending *[]BlogEvent
+
+	// persist, when set, is called with the write lock held after every
+	// mutation. If it fails the mutation is rolled back.
+	persist func(s *memoryStore) error
+}
+
+// NewMemoryStore returns a BlogStore that keeps every blog in memory.
+// It is safe for concurrent use and needs no database.
+func NewMemoryStore() BlogStore {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		items:     make(map[primitive.ObjectID]BlogItem),
+		index:     newInvertedIndex(),
+		slugs:     make(map[slugKey]primitive.ObjectID),
+		revisions: make(map[primitive.ObjectID][]Revision),
+		comments:  make(map[primitive.ObjectID]CommentItem),
+		authors:   make(map[authorKey]AuthorItem),
+		events:    newEventBus(),
+	}
+}
+
+// slugKey is a slug in the namespace of a tenant, slugs being unique per
+// tenant.
+type slugKey struct {
+	tenant, slug string
+}
+
+// authorKey is an author id in the namespace of a tenant, ids being unique
+// per tenant.
+type authorKey struct {
+	tenant, id string
+}
+
+// put stores item under id, or removes id when item is nil, keeping the
+// search index and slugs in step. Callers must hold the write lock.
+func (s *memoryStore) put(id primitive.ObjectID, item *BlogItem) {
+	s.index.remove(id)
+	if prev, ok := s.items[id]; ok {
+		for _, slug := range prev.Slugs {
+			delete(s.slugs, slugKey{prev.Tenant, slug})
+		}
+	}
+	if item == nil {
+		delete(s.items, id)
+		return
+	}
+	s.items[id] = *item
+	s.index.add(item)
+	for _, slug := range item.Slugs {
+		s.slugs[slugKey{item.Tenant, slug}] = id
+	}
+}
+
+// slugTaken reports whether any of slugs belongs to a blog of tenant other
+// than id. Callers must hold the lock.
+func (s *memoryStore) slugTaken(id primitive.ObjectID, tenant string, slugs []string) bool {
+	for _, slug := range slugs {
+		if owner, ok := s.slugs[slugKey{tenant, slug}]; ok && owner != id {
+			return true
+		}
+	}
+	return false
+}
+
+// publish announces a change to item, or holds it back until the
+// transaction the store belongs to commits.
+func (s *memoryStore) publish(typ EventType, item *BlogItem) {
+	s.publishEvent(newBlogEvent(typ, item))
+}
+
+func (s *memoryStore) publishEvent(ev BlogEvent) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, ev)
+		return
+	}
+	s.events.publish(ev)
+}
+
+// removeComments deletes the comments match selects and returns them so
+// they can be put back. Callers must hold the write lock.
+func (s *memoryStore) removeComments(match func(c *CommentItem) bool) []CommentItem {
+	var removed []CommentItem
+	for id, c := range s.comments {
+		if match(&c) {
+			removed = append(removed, c)
+			delete(s.comments, id)
+		}
+	}
+	return removed
+}
+
+func (s *memoryStore) restoreComments(comments []CommentItem) {
+	for _, c := range comments {
+		s.comments[c.ID] = c
+	}
+}
+
+// commit persists the current state, calling undo to roll the mutation
+// back if that fails. Callers must hold the write lock.
+func (s *memoryStore) commit(undo func()) error {
+	if s.persist == nil {
+		return nil
+	}
+	err := s.persist(s)
+	if err != nil {
+		undo()
+	}
+	return err
+}
+
+func (s *memoryStore) Create(ctx context.Context, item *BlogItem) (*BlogItem, error) {
+	created := *item
+	if created.ID.IsZero() {
+		created.ID = primitive.NewObjectID()
+	}
+	created.Version = 1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[created.ID]; ok {
+		return nil, ErrAlreadyExists
+	}
+	if s.slugTaken(created.ID, created.Tenant, created.Slugs) {
+		return nil, ErrSlugTaken
+	}
+
+	s.put(created.ID, &created)
+	if err := s.commit(func() { s.put(created.ID, nil) }); err != nil {
+		return nil, err
+	}
+	s.publish(EventCreated, &created)
+	return &created, nil
+}
+
+func (s *memoryStore) CreateMany(ctx context.Context, items []BlogItem) ([]BlogItem, []error) {
+	created := make([]BlogItem, len(items))
+	for i := range items {
+		created[i] = items[i]
+		if created[i].ID.IsZero() {
+			created[i].ID = primitive.NewObjectID()
+		}
+		created[i].Version = 1
+	}
+	errs := make([]error, len(items))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []int
+	for i := range created {
+		if _, ok := s.items[created[i].ID]; ok {
+			errs[i] = ErrAlreadyExists
+			continue
+		}
+		if s.slugTaken(created[i].ID, created[i].Tenant, created[i].Slugs) {
+			errs[i] = ErrSlugTaken
+			continue
+		}
+		s.put(created[i].ID, &created[i])
+		stored = append(stored, i)
+	}
+	err := s.commit(func() {
+		for _, i := range stored {
+			s.put(created[i].ID, nil)
+		}
+	})
+	if err != nil {
+		for _, i := range stored {
+			errs[i] = err
+		}
+		return created, errs
+	}
+	for _, i := range stored {
+		s.publish(EventCreated, &created[i])
+	}
+	return created, errs
+}
+
+func (s *memoryStore) Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &data, nil
+}
+
+func (s *memoryStore) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]*BlogItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*BlogItem, len(ids))
+	for i, id := range ids {
+		if data, ok := s.items[id]; ok {
+			items[i] = &data
+		}
+	}
+	return items, nil
+}
+
+func (s *memoryStore) GetBySlug(ctx context.Context, tenant, slug string) (*BlogItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.slugs[slugKey{tenant, slug}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data := s.items[id]
+	return &data, nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, item *BlogItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	s.put(item.ID, item)
+	if err := s.commit(func() { s.put(item.ID, &prev) }); err != nil {
+		return err
+	}
+	s.publish(EventUpdated, item)
+	return nil
+}
+
+// update applies u to the blog with the given id and returns it before and
+// after. Callers must hold the write lock and commit the change.
+func (s *memoryStore) update(id primitive.ObjectID, u BlogUpdate) (prev, updated BlogItem, err error) {
+	prev, ok := s.items[id]
+	if !ok || !u.appliesTo(&prev) {
+		return prev, updated, ErrNotFound
+	}
+	if u.IfVersion != 0 && u.IfVersion != prev.Version {
+		return prev, updated, ErrVersionMismatch
+	}
+	updated = prev
+	u.apply(&updated)
+	updated.Version++
+	if s.slugTaken(id, updated.Tenant, updated.Slugs) {
+		return prev, updated, ErrSlugTaken
+	}
+	s.put(id, &updated)
+	return prev, updated, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, updated, err := s.update(id, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(func() { s.put(id, &prev) }); err != nil {
+		return nil, err
+	}
+	s.publish(u.eventType(), &updated)
+	return &updated, nil
+}
+
+func (s *memoryStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, updates []BlogUpdate) ([]BlogItem, []error) {
+	updated := make([]BlogItem, len(ids))
+	errs := make([]error, len(ids))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []int
+	prevs := make([]BlogItem, len(ids))
+	for i, id := range ids {
+		prevs[i], updated[i], errs[i] = s.update(id, updates[i])
+		if errs[i] == nil {
+			stored = append(stored, i)
+		}
+	}
+	err := s.commit(func() {
+		for k := len(stored) - 1; k >= 0; k-- {
+			s.put(ids[stored[k]], &prevs[stored[k]])
+		}
+	})
+	if err != nil {
+		for _, i := range stored {
+			errs[i] = err
+		}
+		return updated, errs
+	}
+	for _, i := range stored {
+		s.publish(updates[i].eventType(), &updated[i])
+	}
+	return updated, errs
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != 0 && ifVersion != prev.Version {
+		return ErrVersionMismatch
+	}
+	s.put(id, nil)
+	revs, hadRevisions := s.revisions[id]
+	delete(s.revisions, id)
+	comments := s.removeComments(func(c *CommentItem) bool { return c.BlogID == id })
+	err := s.commit(func() {
+		s.put(id, &prev)
+		if hadRevisions {
+			s.revisions[id] = revs
+		}
+		s.restoreComments(comments)
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(EventPurged, &prev)
+	return nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, deletedBefore time.Time) ([]BlogItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []BlogItem
+	purgedRevisions := make(map[primitive.ObjectID][]Revision)
+	for id, item := range s.items {
+		if item.DeletedAt != nil && item.DeletedAt.Before(deletedBefore) {
+			purged = append(purged, item)
+			s.put(id, nil)
+			if revs, ok := s.revisions[id]; ok {
+				purgedRevisions[id] = revs
+				delete(s.revisions, id)
+			}
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	purgedComments := s.removeComments(func(c *CommentItem) bool {
+		_, ok := s.items[c.BlogID]
+		return !ok
+	})
+
+	err := s.commit(func() {
+		for i := range purged {
+			s.put(purged[i].ID, &purged[i])
+		}
+		for id, revs := range purgedRevisions {
+			s.revisions[id] = revs
+		}
+		s.restoreComments(purgedComments)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range purged {
+		s.publish(EventPurged, &item)
+	}
+	return purged, nil
+}
+
+func (s *memoryStore) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev []BlogItem
+	for id, item := range s.items {
+		if item.DeletedAt != nil || item.status() != StatusScheduled || (item.PublishAt != nil && item.PublishAt.After(now)) {
+			continue
+		}
+		prev = append(prev, item)
+		item.Status = StatusPublished
+		item.UpdatedAt = now
+		item.Version++
+		s.put(id, &item)
+	}
+	if len(prev) == 0 {
+		return 0, nil
+	}
+
+	err := s.commit(func() {
+		for i := range prev {
+			s.put(prev[i].ID, &prev[i])
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range prev {
+		item := s.items[p.ID]
+		s.publish(EventUpdated, &item)
+	}
+	return int64(len(prev)), nil
+}
+
+// List walks a snapshot of the store so fn may call back into the store
+// without deadlocking.
+func (s *memoryStore) List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error {
+	s.mu.RLock()
+	snapshot := make([]BlogItem, 0, len(s.items))
+	for _, item := range s.items {
+		if opts.matches(&item) {
+			snapshot = append(snapshot, item)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return opts.compare(snapshot[i].cursor(), snapshot[j].cursor()) < 0
+	})
+	if opts.Limit > 0 && len(snapshot) > opts.Limit {
+		snapshot = snapshot[:opts.Limit]
+	}
+
+	for i := range snapshot {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&snapshot[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CountTags(ctx context.Context, tenant, category string) ([]TagCount, error) {
+	s.mu.RLock()
+	counts := make(map[string]int64)
+	for _, item := range s.items {
+		if item.Tenant != tenant || item.DeletedAt != nil || item.status() != StatusPublished || (category != "" && item.Category != category) {
+			continue
+		}
+		for _, t := range item.Tags {
+			counts[t]++
+		}
+	}
+	s.mu.RUnlock()
+
+	out := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		out = append(out, TagCount{Tag: t, Count: n})
+	}
+	sortTagCounts(out)
+	return out, nil
+}
+
+func (s *memoryStore) Search(ctx context.Context, tenant, query string, limit int) ([]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids, scores := s.index.search(query)
+
+	hits := make([]SearchHit, 0, limit)
+	for _, id := range ids {
+		item := s.items[id]
+		if item.Tenant != tenant || item.DeletedAt != nil || item.status() != StatusPublished {
+			continue
+		}
+		hits = append(hits, SearchHit{Item: &item, Score: scores[id]})
+		if limit > 0 && len(hits) == limit {
+			break
+		}
+	}
+	return hits, nil
+}
+
+func (s *memoryStore) Usage(ctx context.Context, tenant string) (TenantUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var usage TenantUsage
+	for _, item := range s.items {
+		if item.Tenant == tenant {
+			usage.Blogs++
+			usage.Bytes += item.size()
+		}
+	}
+	return usage, nil
+}
+
+// addRevision records rev and returns a function undoing it. Callers must
+// hold the write lock and commit the change.
+func (s *memoryStore) addRevision(rev *Revision) func() {
+	prev, had := s.revisions[rev.BlogID]
+	revs := make([]Revision, 0, len(prev)+1)
+	for _, r := range prev {
+		if r.Version != rev.Version {
+			revs = append(revs, r)
+		}
+	}
+	revs = append(revs, *rev)
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Version < revs[j].Version })
+
+	s.revisions[rev.BlogID] = revs
+	return func() {
+		if !had {
+			delete(s.revisions, rev.BlogID)
+		} else {
+			s.revisions[rev.BlogID] = prev
+		}
+	}
+}
+
+func (s *memoryStore) AddRevision(ctx context.Context, rev *Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(s.addRevision(rev))
+}
+
+func (s *memoryStore) AddRevisions(ctx context.Context, revs []Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	undos := make([]func(), len(revs))
+	for i := range revs {
+		undos[i] = s.addRevision(&revs[i])
+	}
+	return s.commit(func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	})
+}
+
+func (s *memoryStore) GetRevision(ctx context.Context, blogID primitive.ObjectID, version int64) (*Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.revisions[blogID] {
+		if r.Version == version {
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ListRevisions(ctx context.Context, blogID primitive.ObjectID, beforeVersion int64, limit int) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revs := s.revisions[blogID]
+	var out []Revision
+	for i := len(revs) - 1; i >= 0; i-- {
+		if beforeVersion != 0 && revs[i].Version >= beforeVersion {
+			continue
+		}
+		out = append(out, revs[i])
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) AddComment(ctx context.Context, c *CommentItem) (*CommentItem, error) {
+	created := *c
+	created.ID = primitive.NewObjectID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.comments[created.ID] = created
+	if err := s.commit(func() { delete(s.comments, created.ID) }); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *memoryStore) GetComment(ctx context.Context, id primitive.ObjectID) (*CommentItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.comments[id]
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+	return &c, nil
+}
+
+func (s *memoryStore) ListComments(ctx context.Context, blogID primitive.ObjectID, parentID *primitive.ObjectID, after primitive.ObjectID, limit int) ([]CommentItem, error) {
+	s.mu.RLock()
+	var out []CommentItem
+	for _, c := range s.comments {
+		if c.BlogID != blogID || (parentID != nil && c.ParentID != *parentID) {
+			continue
+		}
+		if !after.IsZero() && compareIDs(c.ID, after) <= 0 {
+			continue
+		}
+		out = append(out, c)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return compareIDs(out[i].ID, out[j].ID) < 0 })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *memoryStore) DeleteComment(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.comments[id]; !ok {
+		return 0, ErrCommentNotFound
+	}
+	removed := s.removeComments(func(c *CommentItem) bool {
+		if c.ID == id {
+			return true
+		}
+		for _, a := range c.Ancestors {
+			if a == id {
+				return true
+			}
+		}
+		return false
+	})
+	if err := s.commit(func() { s.restoreComments(removed) }); err != nil {
+		return 0, err
+	}
+	return int64(len(removed)), nil
+}
+
+func (s *memoryStore) CreateAuthor(ctx context.Context, a *AuthorItem) (*AuthorItem, error) {
+	created := *a
+	key := authorKey{created.Tenant, created.ID}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authors[key]; ok {
+		return nil, ErrAuthorExists
+	}
+	s.authors[key] = created
+	if err := s.commit(func() { delete(s.authors, key) }); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *memoryStore) GetAuthor(ctx context.Context, tenant, id string) (*AuthorItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.authors[authorKey{tenant, id}]
+	if !ok {
+		return nil, ErrAuthorNotFound
+	}
+	return &a, nil
+}
+
+func (s *memoryStore) UpdateAuthor(ctx context.Context, tenant, id string, u AuthorUpdate) (*AuthorItem, error) {
+	key := authorKey{tenant, id}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.authors[key]
+	if !ok {
+		return nil, ErrAuthorNotFound
+	}
+	updated := prev
+	u.apply(&updated)
+	s.authors[key] = updated
+	if err := s.commit(func() { s.authors[key] = prev }); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *memoryStore) ListAuthors(ctx context.Context, tenant, after string, limit int) ([]AuthorItem, error) {
+	s.mu.RLock()
+	var out []AuthorItem
+	for key, a := range s.authors {
+		if key.tenant == tenant && key.id > after {
+			out = append(out, a)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Atomically runs fn against a copy of the store and swaps the copy in
+// once fn succeeds. Other writers wait until then.
+func (s *memoryStore) Atomically(ctx context.Context, fn func(ctx context.Context, tx BlogStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := newMemoryStore()
+	tx.pending = &[]BlogEvent{}
+	for id, item := range s.items {
+		tx.put(id, &item)
+	}
+	for id, revs := range s.revisions {
+		tx.revisions[id] = append([]Revision(nil), revs...)
+	}
+	for id, c := range s.comments {
+		tx.comments[id] = c
+	}
+	for key, a := range s.authors {
+		tx.authors[key] = a
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	items, index, slugs, revisions, comments, authors := s.items, s.index, s.slugs, s.revisions, s.comments, s.authors
+	s.items, s.index, s.slugs, s.revisions, s.comments, s.authors = tx.items, tx.index, tx.slugs, tx.revisions, tx.comments, tx.authors
+	err := s.commit(func() {
+		s.items, s.index, s.slugs, s.revisions, s.comments, s.authors = items, index, slugs, revisions, comments, authors
+	})
+	if err != nil {
+		return err
+	}
+	for _, ev := range *tx.pending {
+		s.publishEvent(ev)
+	}
+	return nil
+}
+
+func (s *memoryStore) Watch(ctx context.Context, opts WatchOptions, fn func(*BlogEvent) error) error {
+	return s.events.watch(ctx, opts, fn)
+}
+
+// matches reports whether item passes the filters and cursor of opts.
+func (opts *ListOptions) matches(item *BlogItem) bool {
+	if opts.Tenant != nil && item.Tenant != *opts.Tenant {
+		return false
+	}
+	switch {
+	case opts.Deleted == ExcludeDeleted && item.DeletedAt != nil:
+		return false
+	case opts.Deleted == OnlyDeleted && item.DeletedAt == nil:
+		return false
+	}
+	if opts.AuthorID != "" && item.AuthorID != opts.AuthorID {
+		return false
+	}
+	if !strings.HasPrefix(item.Title, opts.TitlePrefix) || !strings.Contains(item.Title, opts.TitleContains) {
+		return false
+	}
+	if len(opts.Tags) > 0 && !item.hasTags(opts.Tags, opts.AllTags) {
+		return false
+	}
+	if opts.Category != "" && item.Category != opts.Category {
+		return false
+	}
+	if len(opts.Statuses) > 0 && !hasStatus(opts.Statuses, item.status()) {
+		return false
+	}
+	if opts.ReaderID != nil && item.status() != StatusPublished && item.AuthorID != *opts.ReaderID {
+		return false
+	}
+
+	// MongoDB stores times in milliseconds, so the bounds are truncated
+	// the same way its driver does.
+	created, _ := item.timestamps()
+	if !opts.CreatedAfter.IsZero() && created.Before(opts.CreatedAfter.Truncate(time.Millisecond)) {
+		return false
+	}
+	if !opts.CreatedBefore.IsZero() && !created.Before(opts.CreatedBefore.Truncate(time.Millisecond)) {
+		return false
+	}
+
+	if opts.After != nil && opts.compare(*opts.After, item.cursor()) >= 0 {
+		return false
+	}
+	return true
+}
+
+// compare orders two positions the way opts sorts the listing.
+func (opts *ListOptions) compare(a, b Cursor) int {
+	c := 0
+	switch opts.SortBy {
+	case SortByCreated:
+		c = compareTimes(a.CreatedAt, b.CreatedAt)
+	case SortByTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case SortByUpdated:
+		c = compareTimes(a.UpdatedAt, b.UpdatedAt)
+	}
+	if c == 0 {
+		c = compareIDs(a.ID, b.ID)
+	}
+	if opts.Descending {
+		return -c
+	}
+	return c
+}
+
+func compareIDs(a, b primitive.ObjectID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
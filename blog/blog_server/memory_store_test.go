@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBlogItemTimestamps(t *testing.T) {
+	created := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	legacy := &BlogItem{ID: primitive.NewObjectIDFromTimestamp(created)}
+
+	tests := []struct {
+		name                 string
+		item                 *BlogItem
+		wantCreated, wantUpd time.Time
+	}{
+		{"recorded", &BlogItem{ID: legacy.ID, CreatedAt: created, UpdatedAt: updated}, created, updated},
+		{"never updated", &BlogItem{ID: legacy.ID, CreatedAt: created}, created, created},
+		{"stored before timestamps", legacy, created, created},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCreated, gotUpd := tt.item.timestamps()
+			if !gotCreated.Equal(tt.wantCreated) || !gotUpd.Equal(tt.wantUpd) {
+				t.Errorf("timestamps = %v, %v, want %v, %v", gotCreated, gotUpd, tt.wantCreated, tt.wantUpd)
+			}
+		})
+	}
+}
@@ -0,0 +1,1117 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// slugIndex is the name of the unique index on every slug of the blogs
+	// of each tenant, which tells its duplicate key errors apart from those
+	// on _id.
+	slugIndex = "tenant_slugs_unique"
+	// oldSlugIndex made slugs unique across tenants.
+	oldSlugIndex = "slugs_unique"
+
+	blogCollection     = "blog"
+	revisionCollection = "blog_revisions"
+	commentCollection  = "blog_comments"
+	authorCollection   = "blog_authors"
+)
+
+type mongoStore struct {
+	coll      *mongo.Collection
+	revisions *mongo.Collection
+	comments  *mongo.Collection
+	authors   *mongo.Collection
+}
+
+// NewMongoStore returns a BlogStore backed by the blog collections of the
+// given MongoDB database.
+func NewMongoStore(db *mongo.Database) BlogStore {
+	return &mongoStore{
+		coll:      db.Collection(blogCollection),
+		revisions: db.Collection(revisionCollection),
+		comments:  db.Collection(commentCollection),
+		authors:   db.Collection(authorCollection),
+	}
+}
+
+func (s *mongoStore) Create(ctx context.Context, item *BlogItem) (*BlogItem, error) {
+	created := *item
+	created.Version = 1
+
+	res, err := s.coll.InsertOne(ctx, created)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, duplicateKeyError(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	oid, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %v to OID", res.InsertedID)
+	}
+
+	created.ID = oid
+	return &created, nil
+}
+
+func (s *mongoStore) CreateMany(ctx context.Context, items []BlogItem) ([]BlogItem, []error) {
+	created := make([]BlogItem, len(items))
+	docs := make([]interface{}, len(items))
+	for i := range items {
+		created[i] = items[i]
+		if created[i].ID.IsZero() {
+			created[i].ID = primitive.NewObjectID()
+		}
+		created[i].Version = 1
+		docs[i] = created[i]
+	}
+	errs := make([]error, len(items))
+
+	_, err := s.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			errs[writeErr.Index] = writeErr
+			if mongo.IsDuplicateKeyError(writeErr) {
+				errs[writeErr.Index] = duplicateKeyError(writeErr)
+			}
+		}
+	} else if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return created, errs
+}
+
+// duplicateKeyError maps a duplicate key error to ErrSlugTaken or
+// ErrAlreadyExists depending on the index it comes from.
+func duplicateKeyError(err error) error {
+	if strings.Contains(err.Error(), slugIndex) {
+		return ErrSlugTaken
+	}
+	return ErrAlreadyExists
+}
+
+func (s *mongoStore) GetBySlug(ctx context.Context, tenant, slug string) (*BlogItem, error) {
+	data := &BlogItem{}
+	err := s.coll.FindOne(ctx, bson.M{"tenant": tenantValue(tenant), "slugs": slug}).Decode(data)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *mongoStore) Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error) {
+	data := &BlogItem{}
+	err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(data)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *mongoStore) Replace(ctx context.Context, item *BlogItem) error {
+	res, err := s.coll.ReplaceOne(ctx, bson.M{"_id": item.ID}, item)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoStore) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]*BlogItem, error) {
+	cur, err := s.coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	found := make(map[primitive.ObjectID]*BlogItem, len(ids))
+	for cur.Next(ctx) {
+		data := &BlogItem{}
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+		found[data.ID] = data
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]*BlogItem, len(ids))
+	for i, id := range ids {
+		items[i] = found[id]
+	}
+	return items, nil
+}
+
+func (s *mongoStore) Update(ctx context.Context, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error) {
+	filter, update := updateQuery(id, u)
+
+	data := &BlogItem{}
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.coll.FindOneAndUpdate(ctx, withVersion(filter, u.IfVersion), update, findOpts).Decode(data)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, s.missing(ctx, filter, u.IfVersion)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UpdateMany applies each update with its own FindOneAndUpdate in one
+// session, so every blog returned is the document its update wrote and
+// every failure is the one Update reports.
+func (s *mongoStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, updates []BlogUpdate) ([]BlogItem, []error) {
+	updated := make([]BlogItem, len(ids))
+	errs := make([]error, len(ids))
+	if len(ids) == 0 {
+		return updated, errs
+	}
+
+	sess, err := s.coll.Database().Client().StartSession()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return updated, errs
+	}
+	defer sess.EndSession(ctx)
+
+	mongo.WithSession(ctx, sess, func(sc mongo.SessionContext) error {
+		for i, id := range ids {
+			data, err := s.Update(sc, id, updates[i])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			updated[i] = *data
+		}
+		return nil
+	})
+	return updated, errs
+}
+
+// updateQuery translates u into the filter and update document writing it
+// to the blog with the given id, leaving its version to the caller.
+func updateQuery(id primitive.ObjectID, u BlogUpdate) (bson.M, bson.M) {
+	set := bson.M{}
+	if u.AuthorID != nil {
+		set["author_id"] = *u.AuthorID
+	}
+	if u.Title != nil {
+		set["title"] = *u.Title
+	}
+	if u.Content != nil {
+		set["content"] = *u.Content
+	}
+	if !u.UpdatedAt.IsZero() {
+		set["updated_at"] = u.UpdatedAt
+	}
+
+	// empty tags, categories and plain formats are left out of documents, as on insert
+	unset := bson.M{}
+	if u.Tags != nil {
+		if len(*u.Tags) > 0 {
+			set["tags"] = *u.Tags
+		} else {
+			unset["tags"] = ""
+		}
+	}
+	if u.Category != nil {
+		if *u.Category != "" {
+			set["category"] = *u.Category
+		} else {
+			unset["category"] = ""
+		}
+	}
+	if u.ContentFormat != nil {
+		if *u.ContentFormat != FormatPlain {
+			set["content_format"] = *u.ContentFormat
+		} else {
+			unset["content_format"] = ""
+		}
+	}
+
+	if u.Status != nil {
+		set["status"] = *u.Status
+		if u.PublishAt != nil {
+			set["publish_at"] = *u.PublishAt
+		} else {
+			unset["publish_at"] = ""
+		}
+	}
+
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if u.Slug != nil {
+		set["slug"] = *u.Slug
+		update["$addToSet"] = bson.M{"slugs": *u.Slug}
+	}
+	if u.Attachment != nil {
+		update["$push"] = bson.M{"attachment_ids": *u.Attachment}
+	}
+	if u.Deleted != nil {
+		if *u.Deleted {
+			set["deleted_at"] = u.UpdatedAt
+		} else {
+			unset["deleted_at"] = ""
+		}
+	}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// only blogs in the trash can be restored, and only those outside it
+	// can be changed otherwise
+	restore := u.Deleted != nil && !*u.Deleted
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": restore}}
+	return filter, update
+}
+
+// purgeStub replaces a blog right before it is deleted, so the change
+// streams of Watch learn the tenant of the blog the delete is about. It
+// stays in the trash should the delete fail, to be purged again.
+type purgeStub struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Tenant    string             `bson:"tenant,omitempty"`
+	DeletedAt time.Time          `bson:"deleted_at"`
+	PurgedAt  time.Time          `bson:"purged_at"`
+}
+
+func newPurgeStub(item *BlogItem) *purgeStub {
+	stub := &purgeStub{ID: item.ID, Tenant: item.Tenant, PurgedAt: time.Now()}
+	stub.DeletedAt = stub.PurgedAt
+	if item.DeletedAt != nil {
+		stub.DeletedAt = *item.DeletedAt
+	}
+	return stub
+}
+
+// purgeProjection keeps the fields of a blog its purgeStub needs.
+var purgeProjection = bson.M{"_id": 1, "tenant": 1, "deleted_at": 1}
+
+func (s *mongoStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int64) error {
+	filter := bson.M{"_id": id}
+	var prev BlogItem
+	err := s.coll.FindOne(ctx, filter, options.FindOne().SetProjection(purgeProjection)).Decode(&prev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	res, err := s.coll.ReplaceOne(ctx, withVersion(filter, ifVersion), newPurgeStub(&prev))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return s.missing(ctx, filter, ifVersion)
+	}
+	if _, err := s.coll.DeleteOne(ctx, filter); err != nil {
+		return err
+	}
+	if _, err := s.revisions.DeleteMany(ctx, bson.M{"blog_id": id}); err != nil {
+		return err
+	}
+	_, err = s.comments.DeleteMany(ctx, bson.M{"blog_id": id})
+	return err
+}
+
+func (s *mongoStore) Purge(ctx context.Context, deletedBefore time.Time) ([]BlogItem, error) {
+	filter := bson.M{"deleted_at": bson.M{"$lt": deletedBefore}}
+	projection := bson.M{"attachment_ids": 1}
+	for field := range purgeProjection {
+		projection[field] = 1
+	}
+	cur, err := s.coll.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	var items []BlogItem
+	var ids bson.A
+	var stubs []mongo.WriteModel
+	for cur.Next(ctx) {
+		var item BlogItem
+		if err := cur.Decode(&item); err != nil {
+			cur.Close(ctx)
+			return nil, err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ID)
+		stubs = append(stubs, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": item.ID, "deleted_at": filter["deleted_at"]}).
+			SetReplacement(newPurgeStub(&item)))
+	}
+	cur.Close(ctx)
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// revisions and comments go first so a failure never leaves them
+	// without their blog
+	if _, err := s.revisions.DeleteMany(ctx, bson.M{"blog_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	if _, err := s.comments.DeleteMany(ctx, bson.M{"blog_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	if _, err := s.coll.BulkWrite(ctx, stubs, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, err
+	}
+
+	// blogs restored meanwhile kept their place and their attachments, only
+	// those replaced by a stub are purged
+	stubbed := bson.M{"_id": bson.M{"$in": ids}, "purged_at": bson.M{"$exists": true}}
+	cur, err = s.coll.Find(ctx, stubbed, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[primitive.ObjectID]bool)
+	for cur.Next(ctx) {
+		var stub purgeStub
+		if err := cur.Decode(&stub); err != nil {
+			cur.Close(ctx)
+			return nil, err
+		}
+		found[stub.ID] = true
+	}
+	cur.Close(ctx)
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := s.coll.DeleteMany(ctx, stubbed); err != nil {
+		return nil, err
+	}
+
+	purged := items[:0]
+	for _, item := range items {
+		if found[item.ID] {
+			purged = append(purged, item)
+		}
+	}
+	return purged, nil
+}
+
+func withVersion(filter bson.M, ifVersion int64) bson.M {
+	if ifVersion == 0 {
+		return filter
+	}
+	versioned := bson.M{"version": ifVersion}
+	for k, v := range filter {
+		versioned[k] = v
+	}
+	return versioned
+}
+
+// missing tells why a conditional write on filter matched nothing.
+func (s *mongoStore) missing(ctx context.Context, filter bson.M, ifVersion int64) error {
+	if ifVersion == 0 {
+		return ErrNotFound
+	}
+	n, err := s.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
+func (s *mongoStore) List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error {
+	filter, findOpts := listQuery(opts)
+
+	cur, err := s.coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &BlogItem{}
+		if err := cur.Decode(data); err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// BackfillTimestamps sets created_at and updated_at from the ObjectID on
+// blogs stored before they were recorded, so they sort like newer ones.
+func BackfillTimestamps(ctx context.Context, db *mongo.Database) error {
+	created := bson.M{"$toDate": "$_id"}
+	_, err := db.Collection(blogCollection).UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"created_at": created,
+			"updated_at": bson.M{"$ifNull": bson.A{"$updated_at", created}},
+		}}}},
+	)
+	return err
+}
+
+// EnsureIndexes creates the text index on title and content that Search
+// relies on, the unique index keeping one revision per blog version and
+// the one keeping author ids unique per tenant. Indexes that already exist
+// are left alone. Blogs stored before created_at was recorded are given
+// the creation time held in their ID.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	const indexNotFound = 27
+
+	_, err := db.Collection(blogCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}},
+		Options: options.Index().
+			SetName("title_content_text").
+			SetWeights(bson.M{"title": titleWeight, "content": 1}),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the old index would keep tenants from using the same slugs
+	_, err = db.Collection(blogCollection).Indexes().DropOne(ctx, oldSlugIndex)
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == indexNotFound) {
+		return err
+	}
+
+	// listings filter and order on created_at alone
+	_, err = db.Collection(blogCollection).UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(blogCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publish_at", Value: 1}}},
+		{
+			// partial rather than sparse, which would still index the blogs
+			// without slugs as they have a tenant
+			Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "slugs", Value: 1}},
+			Options: options.Index().SetName(slugIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"slugs": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(revisionCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "blog_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(commentCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "blog_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "blog_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// authors stored before they had tenants are keyed by their _id
+	_, err = db.Collection(authorCollection).UpdateMany(ctx,
+		bson.M{"id": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"id": "$_id"}}}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection(authorCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// tenantValue matches the tenant field of the blogs and authors of tenant,
+// which is missing for the default one.
+func tenantValue(tenant string) interface{} {
+	if tenant == "" {
+		return nil
+	}
+	return tenant
+}
+
+func (s *mongoStore) CountTags(ctx context.Context, tenant, category string) ([]TagCount, error) {
+	match := bson.M{
+		"tenant":     tenantValue(tenant),
+		"deleted_at": bson.M{"$exists": false},
+		"status":     bson.M{"$in": statusValues(StatusPublished)},
+	}
+	if category != "" {
+		match["category"] = category
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cur, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var counts []TagCount
+	if err := cur.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (s *mongoStore) Search(ctx context.Context, tenant, query string, limit int) ([]SearchHit, error) {
+	score := bson.M{"$meta": "textScore"}
+	findOpts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		findOpts.SetLimit(int64(limit))
+	}
+
+	filter := bson.M{
+		"$text":      bson.M{"$search": query},
+		"tenant":     tenantValue(tenant),
+		"deleted_at": bson.M{"$exists": false},
+		"status":     bson.M{"$in": statusValues(StatusPublished)},
+	}
+	cur, err := s.coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var hits []SearchHit
+	for cur.Next(ctx) {
+		var data struct {
+			BlogItem `bson:",inline"`
+			Score    float64 `bson:"score"`
+		}
+		if err := cur.Decode(&data); err != nil {
+			return nil, err
+		}
+		item := data.BlogItem
+		hits = append(hits, SearchHit{Item: &item, Score: data.Score})
+	}
+	return hits, cur.Err()
+}
+
+func (s *mongoStore) Usage(ctx context.Context, tenant string) (TenantUsage, error) {
+	size := bson.M{"$add": bson.A{
+		bson.M{"$strLenBytes": bson.M{"$ifNull": bson.A{"$title", ""}}},
+		bson.M{"$strLenBytes": bson.M{"$ifNull": bson.A{"$content", ""}}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant": tenantValue(tenant)}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "blogs": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": size}}}},
+	}
+
+	cur, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+	var usage []TenantUsage
+	if err := cur.All(ctx, &usage); err != nil {
+		return TenantUsage{}, err
+	}
+	if len(usage) == 0 {
+		return TenantUsage{}, nil
+	}
+	return usage[0], nil
+}
+
+func (s *mongoStore) AddRevision(ctx context.Context, rev *Revision) error {
+	filter := bson.M{"blog_id": rev.BlogID, "version": rev.Version}
+	_, err := s.revisions.ReplaceOne(ctx, filter, rev, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoStore) AddRevisions(ctx context.Context, revs []Revision) error {
+	if len(revs) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(revs))
+	for i := range revs {
+		filter := bson.M{"blog_id": revs[i].BlogID, "version": revs[i].Version}
+		models[i] = mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(&revs[i]).SetUpsert(true)
+	}
+	_, err := s.revisions.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *mongoStore) GetRevision(ctx context.Context, blogID primitive.ObjectID, version int64) (*Revision, error) {
+	rev := &Revision{}
+	err := s.revisions.FindOne(ctx, bson.M{"blog_id": blogID, "version": version}).Decode(rev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (s *mongoStore) ListRevisions(ctx context.Context, blogID primitive.ObjectID, beforeVersion int64, limit int) ([]Revision, error) {
+	filter := bson.M{"blog_id": blogID}
+	if beforeVersion != 0 {
+		filter["version"] = bson.M{"$lt": beforeVersion}
+	}
+	findOpts := options.Find().SetSort(bson.M{"version": -1})
+	if limit > 0 {
+		findOpts.SetLimit(int64(limit))
+	}
+
+	cur, err := s.revisions.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var revs []Revision
+	if err := cur.All(ctx, &revs); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (s *mongoStore) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	filter := bson.M{
+		"status": StatusScheduled,
+		// like the memory store, a scheduled blog without a time is due
+		"$or": bson.A{
+			bson.M{"publish_at": bson.M{"$exists": false}},
+			bson.M{"publish_at": bson.M{"$lte": now}},
+		},
+		"deleted_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": StatusPublished, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
+	res, err := s.coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// statusValues lists the stored values matching statuses. Blogs stored
+// before statuses existed have none and count as published.
+func statusValues(statuses ...BlogStatus) bson.A {
+	values := bson.A{}
+	for _, status := range statuses {
+		values = append(values, status)
+		if status == StatusPublished {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func (s *mongoStore) AddComment(ctx context.Context, c *CommentItem) (*CommentItem, error) {
+	created := *c
+	created.ID = primitive.NewObjectID()
+
+	if _, err := s.comments.InsertOne(ctx, created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *mongoStore) GetComment(ctx context.Context, id primitive.ObjectID) (*CommentItem, error) {
+	c := &CommentItem{}
+	err := s.comments.FindOne(ctx, bson.M{"_id": id}).Decode(c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *mongoStore) ListComments(ctx context.Context, blogID primitive.ObjectID, parentID *primitive.ObjectID, after primitive.ObjectID, limit int) ([]CommentItem, error) {
+	filter := bson.M{"blog_id": blogID}
+	if parentID != nil {
+		// top-level comments have no parent_id at all
+		filter["parent_id"] = bson.M{"$exists": false}
+		if !parentID.IsZero() {
+			filter["parent_id"] = *parentID
+		}
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	findOpts := options.Find().SetSort(bson.M{"_id": 1})
+	if limit > 0 {
+		findOpts.SetLimit(int64(limit))
+	}
+
+	cur, err := s.comments.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var comments []CommentItem
+	if err := cur.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (s *mongoStore) DeleteComment(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	res, err := s.comments.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"_id": id},
+		bson.M{"ancestors": id},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	if res.DeletedCount == 0 {
+		return 0, ErrCommentNotFound
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoStore) CreateAuthor(ctx context.Context, a *AuthorItem) (*AuthorItem, error) {
+	created := *a
+
+	_, err := s.authors.InsertOne(ctx, created)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAuthorExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// authorFilter matches the author of tenant with the given id.
+func authorFilter(tenant, id string) bson.M {
+	return bson.M{"tenant": tenantValue(tenant), "id": id}
+}
+
+func (s *mongoStore) GetAuthor(ctx context.Context, tenant, id string) (*AuthorItem, error) {
+	a := &AuthorItem{}
+	err := s.authors.FindOne(ctx, authorFilter(tenant, id)).Decode(a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAuthorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *mongoStore) UpdateAuthor(ctx context.Context, tenant, id string, u AuthorUpdate) (*AuthorItem, error) {
+	set := bson.M{"updated_at": u.UpdatedAt}
+	if u.DisplayName != nil {
+		set["display_name"] = *u.DisplayName
+	}
+
+	// empty bios and emails are left out of documents, as on insert
+	unset := bson.M{}
+	if u.Bio != nil {
+		if *u.Bio != "" {
+			set["bio"] = *u.Bio
+		} else {
+			unset["bio"] = ""
+		}
+	}
+	if u.Email != nil {
+		if *u.Email != "" {
+			set["email"] = *u.Email
+		} else {
+			unset["email"] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	a := &AuthorItem{}
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.authors.FindOneAndUpdate(ctx, authorFilter(tenant, id), update, findOpts).Decode(a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAuthorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *mongoStore) ListAuthors(ctx context.Context, tenant, after string, limit int) ([]AuthorItem, error) {
+	filter := bson.M{"tenant": tenantValue(tenant)}
+	if after != "" {
+		filter["id"] = bson.M{"$gt": after}
+	}
+	findOpts := options.Find().SetSort(bson.M{"id": 1})
+	if limit > 0 {
+		findOpts.SetLimit(int64(limit))
+	}
+
+	cur, err := s.authors.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var authors []AuthorItem
+	if err := cur.All(ctx, &authors); err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
+// Atomically runs fn in a MongoDB transaction, which requires a replica
+// set or sharded cluster. fn may be called again if the transaction hits a
+// transient error.
+func (s *mongoStore) Atomically(ctx context.Context, fn func(ctx context.Context, tx BlogStore) error) error {
+	sess, err := s.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc, s)
+	})
+	return err
+}
+
+// Watch follows a MongoDB change stream on the blog collection, which
+// requires a replica set or sharded cluster.
+func (s *mongoStore) Watch(ctx context.Context, opts WatchOptions, fn func(*BlogEvent) error) error {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+	}}}}
+	csOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if opts.ResumeToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.ResumeToken)
+		if err != nil || bson.Raw(raw).Validate() != nil {
+			return ErrInvalidResumeToken
+		}
+		csOpts.SetResumeAfter(bson.Raw(raw))
+	}
+
+	cs, err := s.coll.Watch(ctx, pipeline, csOpts)
+	if err != nil {
+		return changeStreamError(err)
+	}
+	defer cs.Close(ctx)
+
+	for cs.Next(ctx) {
+		var change struct {
+			OperationType string        `bson:"operationType"`
+			FullDocument  bson.RawValue `bson:"fullDocument"`
+			DocumentKey   struct {
+				ID primitive.ObjectID `bson:"_id"`
+			} `bson:"documentKey"`
+			UpdateDescription struct {
+				UpdatedFields bson.M   `bson:"updatedFields"`
+				RemovedFields []string `bson:"removedFields"`
+			} `bson:"updateDescription"`
+		}
+		if err := cs.Decode(&change); err != nil {
+			return err
+		}
+
+		ev := &BlogEvent{
+			BlogID:      change.DocumentKey.ID,
+			ResumeToken: base64.RawURLEncoding.EncodeToString(cs.ResumeToken()),
+		}
+		var stub bool
+		if doc, ok := change.FullDocument.DocumentOK(); ok {
+			ev.Blog = &BlogItem{}
+			if err := bson.Unmarshal(doc, ev.Blog); err != nil {
+				return err
+			}
+			ev.Tenant = ev.Blog.Tenant
+			_, err := doc.LookupErr("purged_at")
+			stub = err == nil
+		}
+		switch {
+		case change.OperationType == "delete":
+			// announced by the purge stub written right before
+			continue
+		case stub:
+			if change.OperationType != "replace" {
+				continue
+			}
+			ev.Type = EventPurged
+			ev.Blog = nil
+		case change.OperationType == "insert":
+			ev.Type = EventCreated
+		default:
+			ev.Type = EventUpdated
+			if _, ok := change.UpdateDescription.UpdatedFields["deleted_at"]; ok {
+				ev.Type = EventDeleted
+			}
+			for _, f := range change.UpdateDescription.RemovedFields {
+				if f == "deleted_at" {
+					ev.Type = EventUndeleted
+				}
+			}
+		}
+
+		// the blog was purged before its update could be looked up, its
+		// purge stub follows
+		if ev.Blog == nil && ev.Type != EventPurged {
+			continue
+		}
+		if !opts.matches(ev) {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return changeStreamError(cs.Err())
+}
+
+// changeStreamError reports a resume point that fell off the oplog as
+// ErrResumeTokenExpired.
+func changeStreamError(err error) error {
+	const changeStreamHistoryLost = 286
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == changeStreamHistoryLost {
+		return ErrResumeTokenExpired
+	}
+	return err
+}
+
+// listQuery translates opts into a MongoDB filter and find options.
+func listQuery(opts ListOptions) (bson.M, *options.FindOptions) {
+	var conds []bson.M
+
+	switch opts.Deleted {
+	case ExcludeDeleted:
+		conds = append(conds, bson.M{"deleted_at": bson.M{"$exists": false}})
+	case OnlyDeleted:
+		conds = append(conds, bson.M{"deleted_at": bson.M{"$exists": true}})
+	}
+	if opts.Tenant != nil {
+		conds = append(conds, bson.M{"tenant": tenantValue(*opts.Tenant)})
+	}
+	if opts.AuthorID != "" {
+		conds = append(conds, bson.M{"author_id": opts.AuthorID})
+	}
+	if opts.TitlePrefix != "" {
+		conds = append(conds, bson.M{"title": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(opts.TitlePrefix)}})
+	}
+	if opts.TitleContains != "" {
+		conds = append(conds, bson.M{"title": primitive.Regex{Pattern: regexp.QuoteMeta(opts.TitleContains)}})
+	}
+	if len(opts.Tags) > 0 {
+		op := "$in"
+		if opts.AllTags {
+			op = "$all"
+		}
+		conds = append(conds, bson.M{"tags": bson.M{op: opts.Tags}})
+	}
+	if opts.Category != "" {
+		conds = append(conds, bson.M{"category": opts.Category})
+	}
+	if len(opts.Statuses) > 0 {
+		conds = append(conds, bson.M{"status": bson.M{"$in": statusValues(opts.Statuses...)}})
+	}
+	if opts.ReaderID != nil {
+		conds = append(conds, bson.M{"$or": bson.A{
+			bson.M{"status": bson.M{"$in": statusValues(StatusPublished)}},
+			bson.M{"author_id": *opts.ReaderID},
+		}})
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conds = append(conds, bson.M{"created_at": bson.M{"$gte": opts.CreatedAfter}})
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conds = append(conds, bson.M{"created_at": bson.M{"$lt": opts.CreatedBefore}})
+	}
+
+	dir, past := 1, "$gt"
+	if opts.Descending {
+		dir, past = -1, "$lt"
+	}
+
+	key := "created_at"
+	switch opts.SortBy {
+	case SortByTitle:
+		key = "title"
+	case SortByUpdated:
+		key = "updated_at"
+	}
+	sort := bson.D{{Key: key, Value: dir}, {Key: "_id", Value: dir}}
+
+	if opts.After != nil {
+		var value interface{} = opts.After.CreatedAt
+		switch opts.SortBy {
+		case SortByTitle:
+			value = opts.After.Title
+		case SortByUpdated:
+			value = opts.After.UpdatedAt
+		}
+		conds = append(conds, bson.M{"$or": bson.A{
+			bson.M{key: bson.M{past: value}},
+			bson.M{key: value, "_id": bson.M{past: opts.After.ID}},
+		}})
+	}
+
+	filter := bson.M{}
+	if len(conds) > 0 {
+		filter["$and"] = conds
+	}
+
+	findOpts := options.Find().SetSort(sort)
+	if opts.Limit > 0 {
+		findOpts.SetLimit(int64(opts.Limit))
+	}
+	return filter, findOpts
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultPageSize is used when a ListBlog caller leaves page_size unset.
+	defaultPageSize = 50
+	// maxPageSize is the largest page the server will stream in one call.
+	maxPageSize = 100
+)
+
+// pageToken is the cursor handed to clients as an opaque next_page_token.
+// It records the ordering it was issued for since the cursor is meaningless
+// under a different one.
+type pageToken struct {
+	LastID     primitive.ObjectID `json:"id"`
+	LastTitle  string             `json:"title,omitempty"`
+	LastCreate int64              `json:"created,omitempty"`
+	LastUpdate int64              `json:"updated,omitempty"`
+	SortBy     SortField          `json:"sort,omitempty"`
+	Descending bool               `json:"desc,omitempty"`
+}
+
+func newPageToken(data *BlogItem, opts ListOptions) pageToken {
+	t := pageToken{
+		LastID:     data.ID,
+		SortBy:     opts.SortBy,
+		Descending: opts.Descending,
+	}
+	switch opts.SortBy {
+	case SortByCreated:
+		t.LastCreate = data.cursor().CreatedAt.UnixNano()
+	case SortByTitle:
+		t.LastTitle = data.Title
+	case SortByUpdated:
+		t.LastUpdate = data.cursor().UpdatedAt.UnixNano()
+	}
+	return t
+}
+
+func encodePageToken(t pageToken) string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+	if s == "" {
+		return t, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(raw, &t)
+	return t, err
+}
+
+// pageSize clamps the requested page size to the server limits.
+func pageSize(requested int32) int {
+	switch {
+	case requested <= 0:
+		return defaultPageSize
+	case requested > maxPageSize:
+		return maxPageSize
+	default:
+		return int(requested)
+	}
+}
+
+// listOptions translates a ListBlog request into store options, resuming
+// from its page token if it has one.
+func listOptions(req *blogpb.ListBlogRequest) (ListOptions, error) {
+	opts := ListOptions{
+		AuthorID:      req.GetAuthorId(),
+		TitlePrefix:   req.GetTitlePrefix(),
+		TitleContains: req.GetTitleContains(),
+		Tags:          normalizeTags(req.GetTags()),
+		AllTags:       req.GetMatchAllTags(),
+		Category:      strings.TrimSpace(req.GetCategory()),
+		Descending:    req.GetDescending(),
+	}
+
+	for _, s := range req.GetStatuses() {
+		status, err := statusFromPb(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Statuses = append(opts.Statuses, status)
+	}
+	if len(opts.Statuses) == 0 {
+		opts.Statuses = []BlogStatus{StatusPublished}
+	}
+
+	switch {
+	case req.GetOnlyDeleted():
+		opts.Deleted = OnlyDeleted
+	case req.GetShowDeleted():
+		opts.Deleted = IncludeDeleted
+	}
+
+	switch req.GetOrderBy() {
+	case blogpb.ListBlogRequest_CREATED:
+		opts.SortBy = SortByCreated
+	case blogpb.ListBlogRequest_TITLE:
+		opts.SortBy = SortByTitle
+	case blogpb.ListBlogRequest_UPDATED:
+		opts.SortBy = SortByUpdated
+	default:
+		return opts, fmt.Errorf("unknown order_by %v", req.GetOrderBy())
+	}
+
+	if req.CreatedAfter != nil {
+		if err := req.GetCreatedAfter().CheckValid(); err != nil {
+			return opts, err
+		}
+		opts.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.CreatedBefore != nil {
+		if err := req.GetCreatedBefore().CheckValid(); err != nil {
+			return opts, err
+		}
+		opts.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	if req.GetPageToken() != "" {
+		token, err := decodePageToken(req.GetPageToken())
+		if err != nil {
+			return opts, fmt.Errorf("invalid page token: %v", err)
+		}
+		if token.SortBy != opts.SortBy || token.Descending != opts.Descending {
+			return opts, errors.New("page token was issued for a different order")
+		}
+		opts.After = &Cursor{
+			ID:        token.LastID,
+			Title:     token.LastTitle,
+			CreatedAt: time.Unix(0, token.LastCreate).UTC(),
+			UpdatedAt: time.Unix(0, token.LastUpdate).UTC(),
+		}
+	}
+
+	opts.Limit = pageSize(req.GetPageSize())
+	return opts, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	created := time.Date(2021, 5, 1, 8, 0, 0, 456, time.UTC)
+	updated := time.Date(2021, 6, 1, 12, 30, 0, 123, time.UTC)
+	item := &BlogItem{ID: primitive.NewObjectID(), Title: "Title", CreatedAt: created, UpdatedAt: updated}
+
+	for _, opts := range []ListOptions{
+		{SortBy: SortByCreated},
+		{SortBy: SortByTitle, Descending: true},
+		{SortBy: SortByUpdated},
+	} {
+		want := newPageToken(item, opts)
+		got, err := decodePageToken(encodePageToken(want))
+		if err != nil {
+			t.Fatalf("decodePageToken: %v", err)
+		}
+		if got != want {
+			t.Errorf("page token = %+v after a round trip, want %+v", got, want)
+		}
+	}
+
+	if token, err := decodePageToken(""); err != nil || token != (pageToken{}) {
+		t.Errorf("decodePageToken(\"\") = %+v, %v, want an empty token", token, err)
+	}
+	for _, bad := range []string{"%%%", "bm90IGpzb24"} {
+		if _, err := decodePageToken(bad); err == nil {
+			t.Errorf("decodePageToken(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		requested int32
+		want      int
+	}{
+		{0, defaultPageSize},
+		{-1, defaultPageSize},
+		{10, 10},
+		{maxPageSize, maxPageSize},
+		{maxPageSize + 1, maxPageSize},
+	}
+	for _, tt := range tests {
+		if got := pageSize(tt.requested); got != tt.want {
+			t.Errorf("pageSize(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestListOptions(t *testing.T) {
+	after := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := primitive.NewObjectID()
+	createdToken := encodePageToken(pageToken{LastID: id, LastCreate: after.UnixNano()})
+	titleToken := encodePageToken(pageToken{LastID: id, LastTitle: "m", SortBy: SortByTitle})
+	updatedToken := encodePageToken(pageToken{LastID: id, LastUpdate: after.UnixNano(), SortBy: SortByUpdated})
+
+	tests := []struct {
+		name    string
+		req     *blogpb.ListBlogRequest
+		want    ListOptions
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			req:  &blogpb.ListBlogRequest{},
+			want: ListOptions{Statuses: []BlogStatus{StatusPublished}, Limit: defaultPageSize},
+		},
+		{
+			name: "filters",
+			req: &blogpb.ListBlogRequest{
+				AuthorId:     "ann",
+				TitlePrefix:  "Go",
+				Tags:         []string{"Go", " go"},
+				Category:     " news ",
+				OnlyDeleted:  true,
+				OrderBy:      blogpb.ListBlogRequest_TITLE,
+				Descending:   true,
+				CreatedAfter: timestamppb.New(after),
+				PageSize:     1000,
+			},
+			want: ListOptions{
+				AuthorID:     "ann",
+				TitlePrefix:  "Go",
+				Tags:         []string{"go"},
+				Category:     "news",
+				Deleted:      OnlyDeleted,
+				SortBy:       SortByTitle,
+				Descending:   true,
+				CreatedAfter: after,
+				Statuses:     []BlogStatus{StatusPublished},
+				Limit:        maxPageSize,
+			},
+		},
+		{
+			name: "page token",
+			req:  &blogpb.ListBlogRequest{OrderBy: blogpb.ListBlogRequest_TITLE, PageToken: titleToken, PageSize: 10},
+			want: ListOptions{
+				SortBy:   SortByTitle,
+				Statuses: []BlogStatus{StatusPublished},
+				After:    &Cursor{ID: id, Title: "m", CreatedAt: time.Unix(0, 0).UTC(), UpdatedAt: time.Unix(0, 0).UTC()},
+				Limit:    10,
+			},
+		},
+		{
+			name: "created page token",
+			req:  &blogpb.ListBlogRequest{PageToken: createdToken},
+			want: ListOptions{
+				Statuses: []BlogStatus{StatusPublished},
+				After:    &Cursor{ID: id, CreatedAt: after, UpdatedAt: time.Unix(0, 0).UTC()},
+				Limit:    defaultPageSize,
+			},
+		},
+		{
+			name: "updated page token",
+			req:  &blogpb.ListBlogRequest{OrderBy: blogpb.ListBlogRequest_UPDATED, PageToken: updatedToken},
+			want: ListOptions{
+				SortBy:   SortByUpdated,
+				Statuses: []BlogStatus{StatusPublished},
+				After:    &Cursor{ID: id, CreatedAt: time.Unix(0, 0).UTC(), UpdatedAt: after},
+				Limit:    defaultPageSize,
+			},
+		},
+		{
+			name:    "page token of another order",
+			req:     &blogpb.ListBlogRequest{OrderBy: blogpb.ListBlogRequest_CREATED, PageToken: titleToken},
+			wantErr: true,
+		},
+		{
+			name:    "malformed page token",
+			req:     &blogpb.ListBlogRequest{PageToken: "not a token"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listOptions(tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("listOptions succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listOptions: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listOptions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Action is a change to a blog a Policy rules on.
+type Action int
+
+const (
+	ActionCreate Action = iota + 1
+	// ActionUpdate covers every change to the content or the publishing
+	// status of a blog, and attaching files to it.
+	ActionUpdate
+	// ActionDelete covers moving a blog to the trash and restoring it.
+	ActionDelete
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Policy decides whether the caller of a request, found in its context with
+// IdentityFromContext, may apply an action to a blog.
+type Policy interface {
+	// Authorize returns nil when the action is allowed, or an
+	// UNAUTHENTICATED or PERMISSION_DENIED status error. For ActionCreate
+	// blog is the blog about to be created.
+	Authorize(ctx context.Context, action Action, blog *BlogItem) error
+	// RequireIdentity returns nil when the caller may make changes tied to no
+	// blog, such as uploading an attachment on its own, or an
+	// UNAUTHENTICATED status error.
+	RequireIdentity(ctx context.Context) error
+	// AuthorizeComment is Authorize for a comment on blog, ActionCreate
+	// covering adding it and ActionDelete removing it with its replies.
+	AuthorizeComment(ctx context.Context, action Action, comment *CommentItem, blog *BlogItem) error
+	// AuthorizeAuthor is Authorize for the profile of an author, ActionCreate
+	// covering registering it and ActionUpdate changing it.
+	AuthorizeAuthor(ctx context.Context, action Action, author *AuthorItem) error
+	// ReadScope returns whose blogs the caller may read besides the
+	// published ones: those of every author when all is set, else those of
+	// authorID, or none when it is empty.
+	ReadScope(ctx context.Context) (authorID string, all bool)
+}
+
+type allowAllPolicy struct{}
+
+// NewAllowAllPolicy returns a Policy allowing everything to everyone, for
+// servers running without authentication.
+func NewAllowAllPolicy() Policy {
+	return allowAllPolicy{}
+}
+
+func (allowAllPolicy) Authorize(ctx context.Context, action Action, blog *BlogItem) error {
+	return nil
+}
+
+func (allowAllPolicy) RequireIdentity(ctx context.Context) error {
+	return nil
+}
+
+func (allowAllPolicy) AuthorizeComment(ctx context.Context, action Action, comment *CommentItem, blog *BlogItem) error {
+	return nil
+}
+
+func (allowAllPolicy) AuthorizeAuthor(ctx context.Context, action Action, author *AuthorItem) error {
+	return nil
+}
+
+func (allowAllPolicy) ReadScope(ctx context.Context) (string, bool) {
+	return "", true
+}
+
+type ownerPolicy struct {
+	adminRole string
+}
+
+// NewOwnerPolicy returns a Policy letting authenticated callers create and
+// change their own blogs only, while callers with adminRole may change any
+// blog. Callers comment under their own name and may delete their comments
+// and those on their blogs. Callers register and change their own author
+// profile only, while admins may change any. Blogs that are not published
+// are only seen by their author and admins.
+func NewOwnerPolicy(adminRole string) Policy {
+	return &ownerPolicy{adminRole: adminRole}
+}
+
+func (p *ownerPolicy) Authorize(ctx context.Context, action Action, blog *BlogItem) error {
+	caller := IdentityFromContext(ctx)
+	if caller == nil {
+		return status.Errorf(codes.Unauthenticated, "Only authenticated callers can %v blogs\n", action)
+	}
+	if caller.Subject == blog.AuthorID || (p.adminRole != "" && caller.HasRole(p.adminRole)) {
+		return nil
+	}
+	if action == ActionCreate {
+		return status.Errorf(codes.PermissionDenied, "Caller %v cannot create blogs for the author %v\n", caller.Subject, blog.AuthorID)
+	}
+	return status.Errorf(codes.PermissionDenied, "Only the author or an admin can %v the blog\n", action)
+}
+
+func (p *ownerPolicy) AuthorizeComment(ctx context.Context, action Action, comment *CommentItem, blog *BlogItem) error {
+	caller := IdentityFromContext(ctx)
+	if caller == nil {
+		return status.Errorf(codes.Unauthenticated, "Only authenticated callers can %v comments\n", action)
+	}
+	if caller.Subject == comment.AuthorID || (p.adminRole != "" && caller.HasRole(p.adminRole)) {
+		return nil
+	}
+	if action == ActionCreate {
+		return status.Errorf(codes.PermissionDenied, "Caller %v cannot comment as the author %v\n", caller.Subject, comment.AuthorID)
+	}
+	if action == ActionDelete && caller.Subject == blog.AuthorID {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "Only the author of the comment or of the blog or an admin can %v the comment\n", action)
+}
+
+func (p *ownerPolicy) AuthorizeAuthor(ctx context.Context, action Action, author *AuthorItem) error {
+	caller := IdentityFromContext(ctx)
+	if caller == nil {
+		return status.Errorf(codes.Unauthenticated, "Only authenticated callers can %v authors\n", action)
+	}
+	if caller.Subject == author.ID || (p.adminRole != "" && caller.HasRole(p.adminRole)) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "Caller %v cannot %v the author %v\n", caller.Subject, action, author.ID)
+}
+
+func (p *ownerPolicy) ReadScope(ctx context.Context) (string, bool) {
+	caller := IdentityFromContext(ctx)
+	if caller == nil {
+		return "", false
+	}
+	return caller.Subject, p.adminRole != "" && caller.HasRole(p.adminRole)
+}
+
+func (p *ownerPolicy) RequireIdentity(ctx context.Context) error {
+	if IdentityFromContext(ctx) == nil {
+		return status.Errorf(codes.Unauthenticated, "Only authenticated callers can make changes\n")
+	}
+	return nil
+}
+
+// authorizeBlog checks that the caller may apply action to the blog with the
+// given id, looked up in store even from the trash, and returns the blog.
+func (s *server) authorizeBlog(ctx context.Context, store BlogStore, action Action, id primitive.ObjectID) (*BlogItem, error) {
+	data, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if err := s.policy.Authorize(ctx, action, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestOwnerPolicy(t *testing.T) {
+	policy := NewOwnerPolicy("admin")
+	blog := &BlogItem{AuthorID: "ann"}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		action Action
+		want   codes.Code
+	}{
+		{"anonymous", context.Background(), ActionUpdate, codes.Unauthenticated},
+		{"author updates", callerContext("ann"), ActionUpdate, codes.OK},
+		{"author deletes", callerContext("ann"), ActionDelete, codes.OK},
+		{"author creates", callerContext("ann"), ActionCreate, codes.OK},
+		{"other updates", callerContext("bob"), ActionUpdate, codes.PermissionDenied},
+		{"other creates for the author", callerContext("bob"), ActionCreate, codes.PermissionDenied},
+		{"admin updates", callerContext("root", "admin"), ActionUpdate, codes.OK},
+		{"other role", callerContext("eve", "editor"), ActionDelete, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(tt.ctx, tt.action, blog)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Authorize: code %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if err := NewAllowAllPolicy().Authorize(context.Background(), ActionDelete, blog); err != nil {
+		t.Errorf("allow-all policy: %v", err)
+	}
+
+	if err := policy.RequireIdentity(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("RequireIdentity of an anonymous caller: error %v, want UNAUTHENTICATED", err)
+	}
+	if err := policy.RequireIdentity(callerContext("eve")); err != nil {
+		t.Errorf("RequireIdentity of an authenticated caller: %v", err)
+	}
+}
+
+func TestUpdateBlogAuthorization(t *testing.T) {
+	authorMask := &fieldmaskpb.FieldMask{Paths: []string{"author_id"}}
+	tests := []struct {
+		name   string
+		caller context.Context
+		author string
+		want   codes.Code
+	}{
+		{"author edits", callerContext("ann"), "ann", codes.OK},
+		{"other edits", callerContext("bob"), "ann", codes.PermissionDenied},
+		{"anonymous edits", context.Background(), "ann", codes.Unauthenticated},
+		{"admin edits", callerContext("root", "admin"), "ann", codes.OK},
+		{"author hands over", callerContext("ann"), "bob", codes.PermissionDenied},
+		{"other takes over", callerContext("bob"), "bob", codes.PermissionDenied},
+		{"admin hands over", callerContext("root", "admin"), "bob", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+			blog := mustCreateBlog(t, s, callerContext("ann"), "ann", "Blog")
+
+			_, err := s.UpdateBlog(tt.caller, &blogpb.UpdateBlogRequest{
+				Blog:       &blogpb.Blog{Id: blog.GetId(), AuthorId: tt.author},
+				UpdateMask: authorMask,
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("UpdateBlog: code %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestRevertBlogAuthorization checks that reverting to a version of another
+// author is a hand-over, which only an admin may do.
+func TestRevertBlogAuthorization(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	blog := mustCreateBlog(t, s, callerContext("ann"), "ann", "Blog")
+	_, err := s.UpdateBlog(callerContext("root", "admin"), &blogpb.UpdateBlogRequest{
+		Blog:       &blogpb.Blog{Id: blog.GetId(), AuthorId: "bob"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"author_id"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revert := &blogpb.RevertBlogRequest{BlogId: blog.GetId(), Version: 1}
+	if _, err := s.RevertBlog(callerContext("bob"), revert); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("owner reverting to a version of another author: error %v, want PERMISSION_DENIED", err)
+	}
+	if _, err := s.RevertBlog(callerContext("ann"), revert); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("former author reverting: error %v, want PERMISSION_DENIED", err)
+	}
+	res, err := s.RevertBlog(callerContext("root", "admin"), revert)
+	if err != nil || res.GetBlog().GetAuthorId() != "ann" {
+		t.Errorf("admin reverting = %v, %v, want the blog back to ann", res.GetBlog(), err)
+	}
+}
+
+func TestDeleteBlogAuthorization(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	blog := mustCreateBlog(t, s, callerContext("ann"), "ann", "Blog")
+	req := &blogpb.DeleteBlogRequest{BlogId: blog.GetId()}
+
+	if _, err := s.DeleteBlog(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("anonymous delete: error %v, want UNAUTHENTICATED", err)
+	}
+	if _, err := s.DeleteBlog(callerContext("bob"), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("delete by another author: error %v, want PERMISSION_DENIED", err)
+	}
+	if _, err := s.DeleteBlog(callerContext("ann"), req); err != nil {
+		t.Errorf("delete by the author: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var blogStatuses = map[BlogStatus]blogpb.Blog_Status{
+	StatusDraft:     blogpb.Blog_DRAFT,
+	StatusScheduled: blogpb.Blog_SCHEDULED,
+	StatusPublished: blogpb.Blog_PUBLISHED,
+	StatusArchived:  blogpb.Blog_ARCHIVED,
+}
+
+// statusFromPb is the reverse of blogStatuses.
+func statusFromPb(s blogpb.Blog_Status) (BlogStatus, error) {
+	for status, pb := range blogStatuses {
+		if pb == s {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("unknown status %v", s)
+}
+
+// publication returns the status and publish time a blog asking for status
+// and publishAt gets at time now. A blog asking for no status is a draft, a
+// blog scheduled for a time that has already passed is published right
+// away, and a published blog remembers when it went live.
+func publication(s blogpb.Blog_Status, publishAt *timestamppb.Timestamp, now time.Time) (BlogStatus, *time.Time) {
+	at := now
+	if publishAt != nil && publishAt.CheckValid() == nil {
+		at = publishAt.AsTime().Truncate(time.Millisecond)
+	}
+
+	switch s {
+	case blogpb.Blog_STATUS_UNSPECIFIED, blogpb.Blog_DRAFT:
+		return StatusDraft, nil
+	case blogpb.Blog_ARCHIVED:
+		return StatusArchived, nil
+	case blogpb.Blog_SCHEDULED:
+		if at.After(now) {
+			return StatusScheduled, &at
+		}
+	}
+	if at.After(now) {
+		at = now
+	}
+	return StatusPublished, &at
+}
+
+// canRead tells whether the caller may read data, which takes the policy
+// letting it read the unpublished blogs of the author unless data is
+// published.
+func canRead(ctx context.Context, policy Policy, data *BlogItem) bool {
+	if data.status() == StatusPublished {
+		return true
+	}
+	authorID, all := policy.ReadScope(ctx)
+	return all || (authorID != "" && authorID == data.AuthorID)
+}
+
+// readableBlog is liveBlog for the blogs the caller may read, the others
+// being as good as missing.
+func readableBlog(ctx context.Context, store BlogStore, policy Policy, id primitive.ObjectID) (*BlogItem, error) {
+	data, err := liveBlog(ctx, store, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead(ctx, policy, data) {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// publishScheduled publishes the scheduled blogs that are due, checking
+// every interval until ctx is done.
+func publishScheduled(ctx context.Context, store BlogStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := store.PublishDue(ctx, now())
+		if err != nil {
+			log.Printf("Error while publishing scheduled blogs: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Published %d scheduled blogs\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) PublishBlog(ctx context.Context, req *blogpb.PublishBlogRequest) (*blogpb.PublishBlogResponse, error) {
+	fmt.Println("PublishBlog invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+	if req.PublishAt != nil {
+		if err := req.GetPublishAt().CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid publish_at: %v\n", err)
+		}
+	}
+
+	if _, err := s.authorizeBlog(ctx, s.store, ActionUpdate, oid); err != nil {
+		return nil, err
+	}
+
+	updatedAt := now()
+	st, publishAt := publication(blogpb.Blog_SCHEDULED, req.GetPublishAt(), updatedAt)
+	data, err := s.store.Update(ctx, oid, BlogUpdate{
+		Status:    &st,
+		PublishAt: publishAt,
+		UpdatedAt: updatedAt,
+		IfVersion: req.GetExpectedVersion(),
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.PublishBlogResponse{
+		Blog: dataToBlogPb(data),
+	}, nil
+}
+
+func (s *server) UnpublishBlog(ctx context.Context, req *blogpb.UnpublishBlogRequest) (*blogpb.UnpublishBlogResponse, error) {
+	fmt.Println("UnpublishBlog invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	if _, err := s.authorizeBlog(ctx, s.store, ActionUpdate, oid); err != nil {
+		return nil, err
+	}
+
+	st := StatusDraft
+	if req.GetArchive() {
+		st = StatusArchived
+	}
+	data, err := s.store.Update(ctx, oid, BlogUpdate{
+		Status:    &st,
+		UpdatedAt: now(),
+		IfVersion: req.GetExpectedVersion(),
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.UnpublishBlogResponse{
+		Blog: dataToBlogPb(data),
+	}, nil
+}
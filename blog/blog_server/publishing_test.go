@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPublication(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		status     blogpb.Blog_Status
+		publishAt  *timestamppb.Timestamp
+		wantStatus BlogStatus
+		wantAt     *time.Time
+	}{
+		{"draft", blogpb.Blog_DRAFT, timestamppb.New(future), StatusDraft, nil},
+		{"unspecified", blogpb.Blog_STATUS_UNSPECIFIED, nil, StatusDraft, nil},
+		{"archived", blogpb.Blog_ARCHIVED, nil, StatusArchived, nil},
+		{"published now", blogpb.Blog_PUBLISHED, nil, StatusPublished, &now},
+		{"published in the past", blogpb.Blog_PUBLISHED, timestamppb.New(past), StatusPublished, &past},
+		{"published in the future", blogpb.Blog_PUBLISHED, timestamppb.New(future), StatusPublished, &now},
+		{"scheduled", blogpb.Blog_SCHEDULED, timestamppb.New(future), StatusScheduled, &future},
+		{"scheduled in the past", blogpb.Blog_SCHEDULED, timestamppb.New(past), StatusPublished, &past},
+		{"scheduled without a time", blogpb.Blog_SCHEDULED, nil, StatusPublished, &now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, at := publication(tt.status, tt.publishAt, now)
+			if status != tt.wantStatus || (at == nil) != (tt.wantAt == nil) || (at != nil && !at.Equal(*tt.wantAt)) {
+				t.Errorf("publication = %v, %v, want %v, %v", status, at, tt.wantStatus, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestBlogVisibility(t *testing.T) {
+	s, _ := newTestServer(t, NewOwnerPolicy("admin"), Quotas{})
+	comments := NewCommentServer(s.store, s.policy)
+	created, err := s.CreateBlog(callerContext("ann"), &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "ann", Title: "Draft"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft := created.GetBlog()
+	if draft.GetStatus() != blogpb.Blog_DRAFT {
+		t.Fatalf("blog created without a status is %v, want DRAFT", draft.GetStatus())
+	}
+	mustCreateBlog(t, s, callerContext("ann"), "ann", "Published")
+
+	tests := []struct {
+		name     string
+		caller   context.Context
+		wantSeen bool
+	}{
+		{"author", callerContext("ann"), true},
+		{"admin", callerContext("root", "admin"), true},
+		{"other", callerContext("bob"), false},
+		{"anonymous", context.Background(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := codes.NotFound
+			if tt.wantSeen {
+				want = codes.OK
+			}
+			_, err := s.ReadBlog(tt.caller, &blogpb.ReadBlogRequest{BlogId: draft.GetId()})
+			if got := status.Code(err); got != want {
+				t.Errorf("ReadBlog of a draft: code %v (%v), want %v", got, err, want)
+			}
+			_, err = s.ReadBlogBySlug(tt.caller, &blogpb.ReadBlogBySlugRequest{Slug: draft.GetSlug()})
+			if got := status.Code(err); got != want {
+				t.Errorf("ReadBlogBySlug of a draft: code %v (%v), want %v", got, err, want)
+			}
+			_, err = comments.ListComments(tt.caller, &blogpb.ListCommentsRequest{BlogId: draft.GetId()})
+			if got := status.Code(err); got != want {
+				t.Errorf("ListComments of a draft: code %v (%v), want %v", got, err, want)
+			}
+
+			stream := &listStream{ctx: tt.caller}
+			req := &blogpb.ListBlogRequest{Statuses: []blogpb.Blog_Status{blogpb.Blog_DRAFT, blogpb.Blog_PUBLISHED}}
+			if err := s.ListBlog(req, stream); err != nil {
+				t.Fatalf("ListBlog: %v", err)
+			}
+			wantListed := 1
+			if tt.wantSeen {
+				wantListed = 2
+			}
+			if len(stream.sent) != wantListed {
+				t.Errorf("ListBlog of drafts and published blogs sent %d blogs, want %d", len(stream.sent), wantListed)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Quota caps what a tenant stores, a zero field meaning no limit.
+type Quota struct {
+	MaxBlogs int64
+	// MaxBytes caps the size of the blogs and attachments together.
+	MaxBytes int64
+}
+
+// Quotas holds the quota of every tenant.
+type Quotas struct {
+	Default Quota
+	// Tenants overrides Default for some tenants.
+	Tenants map[string]Quota
+}
+
+func (q *Quotas) forTenant(tenant string) Quota {
+	if quota, ok := q.Tenants[tenant]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+// LoadQuotas reads the quotas overriding the default one from the file at
+// path. Each line holds a tenant, "-" for the default tenant, and its
+// maximum number of blogs and bytes, 0 for no limit; blank lines and lines
+// starting with # are skipped.
+func LoadQuotas(path string, def Quota) (Quotas, error) {
+	quotas := Quotas{Default: def, Tenants: make(map[string]Quota)}
+	f, err := os.Open(path)
+	if err != nil {
+		return quotas, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return quotas, fmt.Errorf("%s:%d: expected a tenant, a number of blogs and a number of bytes", path, line)
+		}
+		var quota Quota
+		if quota.MaxBlogs, err = strconv.ParseInt(fields[1], 10, 64); err != nil || quota.MaxBlogs < 0 {
+			return quotas, fmt.Errorf("%s:%d: invalid number of blogs %q", path, line, fields[1])
+		}
+		if quota.MaxBytes, err = strconv.ParseInt(fields[2], 10, 64); err != nil || quota.MaxBytes < 0 {
+			return quotas, fmt.Errorf("%s:%d: invalid number of bytes %q", path, line, fields[2])
+		}
+		tenant := fields[0]
+		if tenant == "-" {
+			tenant = ""
+		}
+		quotas.Tenants[tenant] = quota
+	}
+	return quotas, scanner.Err()
+}
+
+// storageLeft returns how many more bytes of blogs and attachments the
+// tenant of ctx may store, or -1 when there is no limit.
+func (s *server) storageLeft(ctx context.Context, store BlogStore) (int64, error) {
+	tenant := TenantFromContext(ctx)
+	quota := s.quotas.forTenant(tenant)
+	if quota.MaxBytes == 0 {
+		return -1, nil
+	}
+
+	usage, err := store.Usage(ctx, tenant)
+	if err != nil {
+		return 0, storeError(err)
+	}
+	attached, err := s.attachments.Usage(ctx, tenant)
+	if err != nil {
+		return 0, storeError(err)
+	}
+	if left := quota.MaxBytes - usage.Bytes - attached; left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
+
+// checkQuota fails with RESOURCE_EXHAUSTED when storing blogs more blogs and
+// bytes more bytes would take the tenant of ctx past its quota. Removing
+// blogs or bytes is always allowed.
+func (s *server) checkQuota(ctx context.Context, store BlogStore, blogs, bytes int64) error {
+	tenant := TenantFromContext(ctx)
+	quota := s.quotas.forTenant(tenant)
+
+	if quota.MaxBlogs > 0 && blogs > 0 {
+		usage, err := store.Usage(ctx, tenant)
+		if err != nil {
+			return storeError(err)
+		}
+		if usage.Blogs+blogs > quota.MaxBlogs {
+			return status.Errorf(codes.ResourceExhausted, "Quota exceeded: %d of %d blogs used, %d more requested\n", usage.Blogs, quota.MaxBlogs, blogs)
+		}
+	}
+
+	if bytes > 0 {
+		left, err := s.storageLeft(ctx, store)
+		if err != nil {
+			return err
+		}
+		if left >= 0 && bytes > left {
+			return status.Errorf(codes.ResourceExhausted, "Quota exceeded: %d bytes requested, %d left of %d\n", bytes, left, quota.MaxBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// pacer spaces out what a stream sends to stay under a rate.
+type pacer struct {
+	// interval is the time taken by one blog, 0 for no limit.
+	interval time.Duration
+	next     time.Time
+}
+
+// newPacer returns a pacer sending up to rate blogs per second, as fast as
+// possible when rate is 0.
+func newPacer(rate float64) *pacer {
+	p := &pacer{}
+	if rate > 0 {
+		p.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return p
+}
+
+// streamRate returns the rate to stream at given the one requested by the
+// client and the server limit, 0 meaning no limit for all three.
+func streamRate(requested, limit float64) float64 {
+	if limit > 0 && (requested == 0 || requested > limit) {
+		return limit
+	}
+	return requested
+}
+
+// wait blocks until n more blogs may be sent, or fails when ctx is done
+// first.
+func (p *pacer) wait(ctx context.Context, n int) error {
+	if p.interval == 0 {
+		return ctx.Err()
+	}
+	now := time.Now()
+	if p.next.After(now) {
+		timer := time.NewTimer(p.next.Sub(now))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		now = p.next
+	}
+	p.next = now.Add(time.Duration(n) * p.interval)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc"
+)
+
+func TestStreamRate(t *testing.T) {
+	tests := []struct {
+		requested, limit, want float64
+	}{
+		{0, 0, 0},
+		{5, 0, 5},
+		{0, 10, 10},
+		{5, 10, 5},
+		{20, 10, 10},
+	}
+	for _, tt := range tests {
+		if got := streamRate(tt.requested, tt.limit); got != tt.want {
+			t.Errorf("streamRate(%v, %v) = %v, want %v", tt.requested, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestPacer(t *testing.T) {
+	ctx := context.Background()
+	p := newPacer(100)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.wait(ctx, 2); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	// the first batch goes at once, the next two wait 20ms each
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 batches of 2 blogs at 100 per second took %v, want at least 40ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := p.wait(cancelled, 1); err != context.Canceled {
+		t.Errorf("wait with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+	if err := newPacer(0).wait(ctx, 1000); err != nil {
+		t.Errorf("wait without a rate = %v, want nil", err)
+	}
+}
+
+// listStream collects the messages a ListBlog call sends.
+type listStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*blogpb.ListBlogResponse
+}
+
+func (s *listStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *listStream) Send(res *blogpb.ListBlogResponse) error {
+	s.sent = append(s.sent, res)
+	return nil
+}
+
+func TestListBlogBatches(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		mustCreateBlog(t, s, ctx, "ann", title)
+	}
+
+	tests := []struct {
+		name      string
+		req       *blogpb.ListBlogRequest
+		wantSizes []int
+		// wantMore tells which messages carry a token resuming the listing,
+		// all but the one ending it
+		wantMore []bool
+	}{
+		{"one by one", &blogpb.ListBlogRequest{PageSize: 3}, []int{1, 1, 1}, []bool{true, true, true}},
+		{"batches", &blogpb.ListBlogRequest{BatchSize: 2}, []int{2, 2, 1}, []bool{true, true, false}},
+		{"batches of a page", &blogpb.ListBlogRequest{PageSize: 4, BatchSize: 3}, []int{3, 1}, []bool{true, true}},
+		{"batch past the page", &blogpb.ListBlogRequest{PageSize: 2, BatchSize: 10}, []int{2}, []bool{true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &listStream{ctx: ctx}
+			if err := s.ListBlog(tt.req, stream); err != nil {
+				t.Fatalf("ListBlog: %v", err)
+			}
+			if len(stream.sent) != len(tt.wantSizes) {
+				t.Fatalf("ListBlog sent %d messages, want %d", len(stream.sent), len(tt.wantSizes))
+			}
+			for i, res := range stream.sent {
+				size := len(res.GetBlogs())
+				if tt.req.GetBatchSize() <= 1 {
+					if res.GetBlog() == nil || size != 0 {
+						t.Errorf("message %d = %v, want a single blog", i, res)
+					}
+					size = 1
+				}
+				if size != tt.wantSizes[i] || (res.GetNextPageToken() != "") != tt.wantMore[i] {
+					t.Errorf("message %d has %d blogs and page token %q, want %d blogs and a token %v",
+						i, size, res.GetNextPageToken(), tt.wantSizes[i], tt.wantMore[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"golang.org/x/net/html"
+)
+
+const (
+	// excerptLength is the number of runes an excerpt is cut to, before the
+	// ellipsis.
+	excerptLength = 200
+	// wordsPerMinute is the reading speed reading times are estimated with.
+	wordsPerMinute = 200
+)
+
+var contentFormats = map[ContentFormat]blogpb.Blog_ContentFormat{
+	FormatPlain:    blogpb.Blog_PLAIN,
+	FormatMarkdown: blogpb.Blog_MARKDOWN,
+	FormatHTML:     blogpb.Blog_HTML,
+}
+
+// formatFromPb is the reverse of contentFormats, unknown formats being
+// plain text.
+func formatFromPb(f blogpb.Blog_ContentFormat) ContentFormat {
+	for format, pb := range contentFormats {
+		if pb == f {
+			return format
+		}
+	}
+	return FormatPlain
+}
+
+// renderContent turns the content of data into sanitized HTML along with
+// its excerpt and reading time.
+func renderContent(data *BlogItem) *blogpb.RenderedContent {
+	var raw string
+	switch data.ContentFormat {
+	case FormatMarkdown:
+		raw = markdownToHTML(data.Content)
+	case FormatHTML:
+		raw = data.Content
+	default:
+		raw = plainToHTML(data.Content)
+	}
+
+	safe, text := sanitizeHTML(raw)
+	words := strings.Fields(text)
+	return &blogpb.RenderedContent{
+		Html:               safe,
+		Excerpt:            excerpt(words),
+		WordCount:          int32(len(words)),
+		ReadingTimeMinutes: int32((len(words) + wordsPerMinute - 1) / wordsPerMinute),
+	}
+}
+
+// renderedBlogPb is dataToBlogPb with the rendered content when render is
+// set.
+func renderedBlogPb(data *BlogItem, render bool) *blogpb.Blog {
+	blog := dataToBlogPb(data)
+	if render {
+		blog.Rendered = renderContent(data)
+	}
+	return blog
+}
+
+// plainToHTML makes a paragraph of every block of text separated by blank
+// lines, keeping the line breaks inside them.
+func plainToHTML(text string) string {
+	var b strings.Builder
+	for _, para := range blankLines.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(para), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// excerpt joins words up to excerptLength runes, adding an ellipsis when
+// some are left out.
+func excerpt(words []string) string {
+	var b strings.Builder
+	n := 0
+	for i, w := range words {
+		l := utf8.RuneCountInString(w)
+		if i > 0 {
+			l++
+		}
+		if n+l > excerptLength {
+			if n == 0 {
+				// a single word longer than the whole excerpt
+				r := []rune(w)
+				b.WriteString(string(r[:excerptLength]))
+			}
+			b.WriteString("…")
+			break
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w)
+		n += l
+	}
+	return b.String()
+}
+
+// allowedTags lists the elements kept by sanitizeHTML with the attributes
+// they may carry.
+var allowedTags = map[string]map[string]bool{
+	"a":          {"href": true, "title": true},
+	"abbr":       {"title": true},
+	"b":          {},
+	"blockquote": {},
+	"br":         {},
+	"code":       {"class": true},
+	"dd":         {},
+	"del":        {},
+	"div":        {},
+	"dl":         {},
+	"dt":         {},
+	"em":         {},
+	"h1":         {},
+	"h2":         {},
+	"h3":         {},
+	"h4":         {},
+	"h5":         {},
+	"h6":         {},
+	"hr":         {},
+	"i":          {},
+	"img":        {"src": true, "alt": true, "title": true},
+	"li":         {},
+	"ol":         {"start": true},
+	"p":          {},
+	"pre":        {},
+	"s":          {},
+	"span":       {},
+	"strong":     {},
+	"sub":        {},
+	"sup":        {},
+	"table":      {},
+	"tbody":      {},
+	"td":         {},
+	"th":         {},
+	"thead":      {},
+	"tr":         {},
+	"u":          {},
+	"ul":         {},
+}
+
+// droppedTags lists the elements removed by sanitizeHTML together with
+// everything inside them.
+var droppedTags = map[string]bool{
+	"applet":   true,
+	"embed":    true,
+	"frame":    true,
+	"frameset": true,
+	"head":     true,
+	"iframe":   true,
+	"math":     true,
+	"noembed":  true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"xmp":      true,
+}
+
+// voidTags are the allowed elements that have no end tag.
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// blockTags are the elements whose text is not joined to the text around
+// them.
+var blockTags = map[string]bool{
+	"blockquote": true, "br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+	"li": true, "ol": true, "p": true, "pre": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+var (
+	codeClass = regexp.MustCompile(`^language-[A-Za-z0-9_+-]+$`)
+	digits    = regexp.MustCompile(`^[0-9]{1,9}$`)
+
+	blankLines = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+// sanitizeHTML keeps the allowed elements and attributes of src, escaping
+// all text, and returns the result with the text it holds. Unclosed
+// elements are closed and stray end tags dropped, so the output can be
+// embedded anywhere in a page.
+func sanitizeHTML(src string) (string, string) {
+	var out, text strings.Builder
+	var open []string
+	// skip counts the dropped elements the tokenizer is in
+	skip := 0
+
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		tok := z.Token()
+
+		switch tt {
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			out.WriteString(html.EscapeString(tok.Data))
+			text.WriteString(tok.Data)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if blockTags[tok.Data] {
+				text.WriteByte(' ')
+			}
+			attrs, ok := allowedTags[tok.Data]
+			if skip > 0 || !ok {
+				continue
+			}
+			out.WriteString("<" + tok.Data)
+			for _, a := range tok.Attr {
+				if a.Namespace != "" || !attrs[a.Key] || !safeAttr(tok.Data, a.Key, a.Val) {
+					continue
+				}
+				out.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+			if tok.Data == "a" {
+				out.WriteString(` rel="nofollow noopener noreferrer"`)
+			}
+			out.WriteString(">")
+			if !voidTags[tok.Data] {
+				open = append(open, tok.Data)
+			}
+		case html.EndTagToken:
+			if droppedTags[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if blockTags[tok.Data] {
+				text.WriteByte(' ')
+			}
+			if skip > 0 {
+				continue
+			}
+			// close the elements left open inside this one
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.Data {
+					for _, t := range reverse(open[i:]) {
+						out.WriteString("</" + t + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+	for _, t := range reverse(open) {
+		out.WriteString("</" + t + ">")
+	}
+	return out.String(), text.String()
+}
+
+func reverse(tags []string) []string {
+	r := make([]string, len(tags))
+	for i, t := range tags {
+		r[len(tags)-1-i] = t
+	}
+	return r
+}
+
+// safeAttr reports whether the value of an allowed attribute is harmless.
+func safeAttr(tag, key, val string) bool {
+	switch key {
+	case "href", "src":
+		return safeURL(val, tag == "a")
+	case "class":
+		return codeClass.MatchString(val)
+	case "start":
+		return digits.MatchString(val)
+	}
+	return true
+}
+
+// safeURL reports whether u is relative or uses http or https, or mailto
+// when mail is set.
+func safeURL(u string, mail bool) bool {
+	// browsers ignore these characters inside schemes, so "java\tscript:"
+	// must not get through
+	u = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, u)
+	u = strings.TrimFunc(u, func(r rune) bool { return r <= ' ' || unicode.IsSpace(r) })
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "":
+		// a colon before any slash would be read as a scheme by browsers
+		colon := strings.IndexByte(u, ':')
+		return colon < 0 || strings.IndexAny(u[:colon], "/?#") >= 0
+	case "http", "https":
+		return true
+	case "mailto":
+		return mail
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantHTML string
+		wantText string
+	}{
+		{"allowed markup", `<p>Hello <b>world</b></p>`, `<p>Hello <b>world</b></p>`, ` Hello world `},
+		{"script dropped with its content", `a<script>alert(1)</script>b`, `ab`, `ab`},
+		{"unknown element unwrapped", `<blink>hi</blink>`, `hi`, `hi`},
+		{"event handler dropped", `<b onclick="x()">hi</b>`, `<b>hi</b>`, `hi`},
+		{"javascript link dropped", `<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`, `x`},
+		{"scheme split by a tab", "<a href=\"java\tscript:alert(1)\">x</a>", `<a rel="nofollow noopener noreferrer">x</a>`, `x`},
+		{"http link kept", `<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer">x</a>`, `x`},
+		{"text escaped", `1 &lt; 2 & "q"`, `1 &lt; 2 &amp; &#34;q&#34;`, `1 < 2 & "q"`},
+		{"unclosed elements closed", `<ul><li><i>x`, `<ul><li><i>x</i></li></ul>`, `  x`},
+		{"stray end tag dropped", `x</b></p>`, `x`, `x `},
+		{"code class checked", `<code class="language-go">x</code><code class="evil x">y</code>`, `<code class="language-go">x</code><code>y</code>`, `xy`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHTML, gotText := sanitizeHTML(tt.src)
+			if gotHTML != tt.wantHTML {
+				t.Errorf("sanitizeHTML(%q) html = %q, want %q", tt.src, gotHTML, tt.wantHTML)
+			}
+			if gotText != tt.wantText {
+				t.Errorf("sanitizeHTML(%q) text = %q, want %q", tt.src, gotText, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"heading", "# Title", "<h1>Title</h1>\n"},
+		{"paragraph with emphasis", "some *em* and **strong** `code`", "<p>some <em>em</em> and <strong>strong</strong> <code>code</code></p>\n"},
+		{"list", "- a\n- b", "<ul>\n<li>a\n</li>\n<li>b\n</li>\n</ul>\n"},
+		{"link", "[go](https://go.dev)", "<p><a href=\"https://go.dev\">go</a></p>\n"},
+		{"raw html as text", "<b>x</b>", "<p>&lt;b&gt;x&lt;/b&gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToHTML(tt.src); got != tt.want {
+				t.Errorf("markdownToHTML(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderContent(t *testing.T) {
+	long := strings.Repeat("word ", 450)
+	got := renderContent(&BlogItem{Content: "one <two>\n\nthree " + long})
+	if want := "<p>one &lt;two&gt;</p>\n<p>three "; !strings.HasPrefix(got.GetHtml(), want) {
+		t.Errorf("html = %q, want it to start with %q", got.GetHtml(), want)
+	}
+	if got.GetWordCount() != 453 || got.GetReadingTimeMinutes() != 3 {
+		t.Errorf("word count %d and reading time %d, want 453 and 3", got.GetWordCount(), got.GetReadingTimeMinutes())
+	}
+	if n := utf8.RuneCountInString(got.GetExcerpt()); n > excerptLength+1 || !strings.HasSuffix(got.GetExcerpt(), "…") {
+		t.Errorf("excerpt of %d runes = %q, want at most %d and an ellipsis", n, got.GetExcerpt(), excerptLength+1)
+	}
+}
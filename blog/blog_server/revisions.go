@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxUpdateAttempts bounds how often an update without an expected version
+// is retried when another writer gets in between reading and writing.
+const maxUpdateAttempts = 3
+
+// updateWithHistory applies u to a live blog after recording its current
+// state as a revision. The write is made conditional on the version that was
+// recorded so no state is ever lost from the history.
+func updateWithHistory(ctx context.Context, store BlogStore, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error) {
+	for attempt := 1; ; attempt++ {
+		prev, err := liveBlog(ctx, store, id)
+		if err != nil {
+			return nil, err
+		}
+		if u.IfVersion != 0 && u.IfVersion != prev.Version {
+			return nil, ErrVersionMismatch
+		}
+
+		err = store.AddRevision(ctx, &Revision{BlogID: id, Version: prev.Version, Blog: *prev})
+		if err != nil {
+			return nil, err
+		}
+
+		cond := u
+		cond.IfVersion = prev.Version
+		// a new title gets a new slug, or one the blog had before
+		if u.Title != nil && *u.Title != prev.Title {
+			slug, err := uniqueSlug(ctx, store, slugify(*u.Title), id, nil)
+			if err != nil {
+				return nil, err
+			}
+			cond.Slug = &slug
+		}
+
+		data, err := store.Update(ctx, id, cond)
+		if errors.Is(err, ErrVersionMismatch) && u.IfVersion == 0 && attempt < maxUpdateAttempts {
+			continue
+		}
+		if errors.Is(err, ErrSlugTaken) && attempt < maxUpdateAttempts {
+			continue
+		}
+		return data, err
+	}
+}
+
+// liveBlog returns the blog with the given id unless it is in the trash.
+func liveBlog(ctx context.Context, store BlogStore, id primitive.ObjectID) (*BlogItem, error) {
+	data, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// revision returns the given version of a live blog, which may be its
+// current state.
+func (s *server) revision(ctx context.Context, id primitive.ObjectID, version int64) (*BlogItem, error) {
+	current, err := readableBlog(ctx, s.store, s.policy, id)
+	if err != nil {
+		return nil, err
+	}
+	if version == current.Version {
+		return current, nil
+	}
+	if version > current.Version {
+		return nil, ErrNotFound
+	}
+
+	rev, err := s.store.GetRevision(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return &rev.Blog, nil
+}
+
+func (s *server) ListBlogRevisions(ctx context.Context, req *blogpb.ListBlogRevisionsRequest) (*blogpb.ListBlogRevisionsResponse, error) {
+	fmt.Println("ListBlogRevisions invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	// the page token is the version the previous page stopped at
+	before := int64(0)
+	if req.GetPageToken() != "" {
+		before, err = strconv.ParseInt(req.GetPageToken(), 10, 64)
+		if err != nil || before <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid page token: %q\n", req.GetPageToken())
+		}
+	}
+
+	current, err := readableBlog(ctx, s.store, s.policy, oid)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	// a revision may be left at the current version by an update that failed
+	if before == 0 || before > current.Version {
+		before = current.Version
+	}
+
+	size := pageSize(req.GetPageSize())
+	revs, err := s.store.ListRevisions(ctx, oid, before, size+1)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ListBlogRevisionsResponse{}
+	if len(revs) > size {
+		revs = revs[:size]
+		res.NextPageToken = strconv.FormatInt(revs[size-1].Version, 10)
+	}
+	for i := range revs {
+		res.Revisions = append(res.Revisions, dataToBlogPb(&revs[i].Blog))
+	}
+	return res, nil
+}
+
+func (s *server) GetBlogRevision(ctx context.Context, req *blogpb.GetBlogRevisionRequest) (*blogpb.GetBlogRevisionResponse, error) {
+	fmt.Println("GetBlogRevision invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	data, err := s.revision(ctx, oid, req.GetVersion())
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.GetBlogRevisionResponse{
+		Blog: dataToBlogPb(data),
+	}, nil
+}
+
+func (s *server) DiffBlogRevisions(ctx context.Context, req *blogpb.DiffBlogRevisionsRequest) (*blogpb.DiffBlogRevisionsResponse, error) {
+	fmt.Println("DiffBlogRevisions invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	from, err := s.revision(ctx, oid, req.GetFromVersion())
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var to *BlogItem
+	if req.GetToVersion() == 0 {
+		to, err = readableBlog(ctx, s.store, s.policy, oid)
+	} else {
+		to, err = s.revision(ctx, oid, req.GetToVersion())
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.DiffBlogRevisionsResponse{}
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"author_id", from.AuthorID, to.AuthorID},
+		{"title", from.Title, to.Title},
+		{"content", from.Content, to.Content},
+		{"tags", strings.Join(from.Tags, "\n"), strings.Join(to.Tags, "\n")},
+		{"category", from.Category, to.Category},
+		{"content_format", contentFormats[from.ContentFormat].String(), contentFormats[to.ContentFormat].String()},
+	}
+	for _, f := range fields {
+		if f.from == f.to {
+			continue
+		}
+		diff, err := lineDiff(f.from, f.to)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "Cannot diff the %v of the versions: %v\n", f.name, err)
+		}
+		res.Changes = append(res.Changes, &blogpb.FieldDiff{
+			Field: f.name,
+			From:  f.from,
+			To:    f.to,
+			Diff:  diff,
+		})
+	}
+	return res, nil
+}
+
+func (s *server) RevertBlog(ctx context.Context, req *blogpb.RevertBlogRequest) (*blogpb.RevertBlogResponse, error) {
+	fmt.Println("RevertBlog invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	current, err := s.authorizeBlog(ctx, s.store, ActionUpdate, oid)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.revision(ctx, oid, req.GetVersion())
+	if err != nil {
+		return nil, storeError(err)
+	}
+	update := BlogUpdate{
+		AuthorID:  &rev.AuthorID,
+		Title:     &rev.Title,
+		Content:   &rev.Content,
+		Tags:      &rev.Tags,
+		Category:  &rev.Category,
+		UpdatedAt: now(),
+		IfVersion: req.GetExpectedVersion(),
+
+		ContentFormat: &rev.ContentFormat,
+	}
+	// reverting to a version of another author hands the blog over to them
+	if _, err := s.authorizeChange(ctx, current, update); err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(ctx, s.store, 0, rev.size()-current.size()); err != nil {
+		return nil, err
+	}
+
+	data, err := updateWithHistory(ctx, s.store, oid, update)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &blogpb.RevertBlogResponse{
+		Blog: dataToBlogPb(data),
+	}, nil
+}
+
+// maxDiffCells bounds the lines of one side times the lines of the other
+// that lineDiff compares once their common head and tail are left out, which
+// keeps the time and memory of a diff in check.
+const maxDiffCells = 4 << 20
+
+// errDiffTooLarge is returned by lineDiff for texts too far apart to diff.
+var errDiffTooLarge = errors.New("too many changed lines to diff")
+
+// lineDiff compares a and b line by line using their longest common
+// subsequence and prefixes each line with "  " when kept, "- " when removed
+// or "+ " when added.
+func lineDiff(a, b string) (string, error) {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lines kept at both ends need no table
+	var head, tail []string
+	for len(x) > 0 && len(y) > 0 && x[0] == y[0] {
+		head = append(head, "  "+x[0])
+		x, y = x[1:], y[1:]
+	}
+	for len(x) > 0 && len(y) > 0 && x[len(x)-1] == y[len(y)-1] {
+		tail = append(tail, "  "+x[len(x)-1])
+		x, y = x[:len(x)-1], y[:len(y)-1]
+	}
+	if int64(len(x)+1)*int64(len(y)+1) > maxDiffCells {
+		return "", errDiffTooLarge
+	}
+
+	// lcs[i*w+j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	w := len(y) + 1
+	lcs := make([]int32, (len(x)+1)*w)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else if lcs[(i+1)*w+j] >= lcs[i*w+j+1] {
+				lcs[i*w+j] = lcs[(i+1)*w+j]
+			} else {
+				lcs[i*w+j] = lcs[i*w+j+1]
+			}
+		}
+	}
+
+	out := head
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out = append(out, "  "+x[i])
+			i++
+			j++
+		case j == len(y) || (i < len(x) && lcs[(i+1)*w+j] >= lcs[i*w+j+1]):
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for k := len(tail) - 1; k >= 0; k-- {
+		out = append(out, tail[k])
+	}
+	return strings.Join(out, "\n"), nil
+}
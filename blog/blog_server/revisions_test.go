@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb", "a\nb", "  a\n  b"},
+		{"added", "a\nc", "a\nb\nc", "  a\n+ b\n  c"},
+		{"removed", "a\nb\nc", "a\nc", "  a\n- b\n  c"},
+		{"changed", "a\nb\nc", "a\nx\nc", "  a\n- b\n+ x\n  c"},
+		{"from empty", "", "a", "- \n+ a"},
+		{"middle kept", "x\nm\ny", "p\nm\nq", "- x\n+ p\n  m\n- y\n+ q"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lineDiff(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("lineDiff: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("lineDiff(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineDiffTooLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 3000; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+	if _, err := lineDiff(a.String(), b.String()); !errors.Is(err, errDiffTooLarge) {
+		t.Errorf("lineDiff of texts with no line in common: error = %v, want %v", err, errDiffTooLarge)
+	}
+
+	// a long common head and tail leave little to compare
+	same := a.String()
+	got, err := lineDiff(same+"x\n"+same, same+"y\n"+same)
+	if err != nil {
+		t.Fatalf("lineDiff of texts differing by a line: %v", err)
+	}
+	if !strings.Contains(got, "\n- x\n+ y\n") {
+		t.Errorf("lineDiff of texts differing by a line misses the change")
+	}
+}
+
+func TestRevertBlog(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+
+	created, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "ann", Title: "first", Content: "one"}})
+	if err != nil {
+		t.Fatalf("CreateBlog: %v", err)
+	}
+	id := created.GetBlog().GetId()
+	if _, err := s.UpdateBlog(ctx, &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: id, AuthorId: "ann", Title: "second", Content: "two"}}); err != nil {
+		t.Fatalf("UpdateBlog: %v", err)
+	}
+
+	revs, err := s.ListBlogRevisions(ctx, &blogpb.ListBlogRevisionsRequest{BlogId: id})
+	if err != nil {
+		t.Fatalf("ListBlogRevisions: %v", err)
+	}
+	if len(revs.GetRevisions()) != 1 || revs.GetRevisions()[0].GetTitle() != "first" {
+		t.Fatalf("ListBlogRevisions = %v, want the first version", revs.GetRevisions())
+	}
+
+	reverted, err := s.RevertBlog(ctx, &blogpb.RevertBlogRequest{BlogId: id, Version: 1, ExpectedVersion: 2})
+	if err != nil {
+		t.Fatalf("RevertBlog: %v", err)
+	}
+	if got := reverted.GetBlog(); got.GetTitle() != "first" || got.GetContent() != "one" || got.GetVersion() != 3 {
+		t.Errorf("RevertBlog = %v, want the first title and content at version 3", got)
+	}
+	if _, err := s.RevertBlog(ctx, &blogpb.RevertBlogRequest{BlogId: id, Version: 1, ExpectedVersion: 2}); status.Code(err) != codes.Aborted {
+		t.Errorf("RevertBlog at a stale version: code = %v, want %v", status.Code(err), codes.Aborted)
+	}
+}
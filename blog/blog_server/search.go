@@ -0,0 +1,176 @@
+package main
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// titleWeight makes a match in the title count more than one in the
+	// content, for both the MongoDB text index and the inverted index.
+	titleWeight = 2
+	// snippetLength is the approximate number of runes in a content snippet.
+	snippetLength = 160
+)
+
+// SearchHit is a blog matching a search query together with its relevance.
+type SearchHit struct {
+	Item  *BlogItem
+	Score float64
+}
+
+// tokenize splits text into lower-cased words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// invertedIndex maps every word to the blogs containing it. It is the
+// full-text search used by stores without a MongoDB text index and is not
+// safe for concurrent use on its own.
+type invertedIndex struct {
+	// postings holds the weighted term frequency of a word in each blog.
+	postings map[string]map[primitive.ObjectID]float64
+	// terms remembers the words indexed for each blog so it can be removed.
+	terms map[primitive.ObjectID][]string
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: make(map[string]map[primitive.ObjectID]float64),
+		terms:    make(map[primitive.ObjectID][]string),
+	}
+}
+
+func (idx *invertedIndex) add(item *BlogItem) {
+	freq := make(map[string]float64)
+	for _, t := range tokenize(item.Title) {
+		freq[t] += titleWeight
+	}
+	for _, t := range tokenize(item.Content) {
+		freq[t]++
+	}
+
+	terms := make([]string, 0, len(freq))
+	for t, f := range freq {
+		if idx.postings[t] == nil {
+			idx.postings[t] = make(map[primitive.ObjectID]float64)
+		}
+		idx.postings[t][item.ID] = f
+		terms = append(terms, t)
+	}
+	idx.terms[item.ID] = terms
+}
+
+func (idx *invertedIndex) remove(id primitive.ObjectID) {
+	for _, t := range idx.terms[id] {
+		delete(idx.postings[t], id)
+		if len(idx.postings[t]) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+	delete(idx.terms, id)
+}
+
+// search scores every blog containing at least one query word with tf-idf
+// and returns the ids ordered by descending score.
+func (idx *invertedIndex) search(query string) ([]primitive.ObjectID, map[primitive.ObjectID]float64) {
+	docs := float64(len(idx.terms))
+	scores := make(map[primitive.ObjectID]float64)
+
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		posting := idx.postings[t]
+		if len(posting) == 0 {
+			continue
+		}
+		idf := math.Log(1 + docs/float64(len(posting)))
+		for id, f := range posting {
+			scores[id] += (1 + math.Log(f)) * idf
+		}
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return compareIDs(ids[i], ids[j]) < 0
+	})
+	return ids, scores
+}
+
+// highlight wraps every word of text found in terms with pre and post,
+// escaping text so the result is safe to use as HTML. When maxLen is
+// positive the result is cut to a window of about maxLen runes around the
+// first match.
+func highlight(text string, terms map[string]bool, pre, post string, maxLen int) string {
+	runes := []rune(text)
+
+	type span struct{ start, end int }
+	var matches []span
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsNumber(runes[j])) {
+			j++
+		}
+		if terms[strings.ToLower(string(runes[i:j]))] {
+			matches = append(matches, span{i, j})
+		}
+		i = j
+	}
+
+	start, end := 0, len(runes)
+	if maxLen > 0 && len(runes) > maxLen {
+		if len(matches) > 0 {
+			start = matches[0].start - maxLen/4
+			if start < 0 {
+				start = 0
+			}
+		}
+		end = start + maxLen
+		if end > len(runes) {
+			end = len(runes)
+			start = end - maxLen
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m.start < start || m.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:m.start])))
+		b.WriteString(pre)
+		b.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		b.WriteString(post)
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
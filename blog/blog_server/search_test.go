@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	terms := map[string]bool{"go": true, "grpc": true}
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{"whole words", "Go and gRPC, not gopher", 0, "<b>Go</b> and <b>gRPC</b>, not gopher"},
+		{"no match", "nothing here", 0, "nothing here"},
+		{"escaped", `<script>go</script> & "go"`, 0, "&lt;script&gt;<b>go</b>&lt;/script&gt; &amp; &#34;<b>go</b>&#34;"},
+		{"window", "one two three four five six seven go eight nine ten", 16, "…ven <b>go</b> eight nin…"},
+		{"window without match", "one two three four", 7, "one two…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.text, terms, "<b>", "</b>", tt.maxLen); got != tt.want {
+				t.Errorf("highlight(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
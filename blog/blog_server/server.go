@@ -2,198 +2,550 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-var Collection *mongo.Collection
-
 type server struct {
 	blogpb.UnimplementedBlogServiceServer
+	store       BlogStore
+	attachments AttachmentStore
+	// maxAttachmentSize is the largest upload accepted, in bytes.
+	maxAttachmentSize int64
+	// policy rules on every change to a blog.
+	policy Policy
+	quotas Quotas
+	// maxListRate caps the blogs per second a ListBlog call streams, 0 for
+	// no limit.
+	maxListRate float64
 }
 
-type BlogItem struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	AuthorID string             `bson:"author_id"`
-	Content  string             `bson:"content"`
-	Title    string             `bson:"title"`
+func NewServer(store BlogStore, attachments AttachmentStore, maxAttachmentSize int64, policy Policy, quotas Quotas, maxListRate float64) *server {
+	return &server{store: store, attachments: attachments, maxAttachmentSize: maxAttachmentSize, policy: policy, quotas: quotas, maxListRate: maxListRate}
 }
 
-func NewServer() *server {
-	return &server{}
+// now is the time recorded on writes. It is cut to the millisecond
+// precision of BSON dates so every backend returns the same values.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
 
-func (*server) CreateBlog(ctx context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
-	fmt.Println("CreateBlog invoked")
+func dataToBlogPb(data *BlogItem) *blogpb.Blog {
+	created, updated := data.timestamps()
+	blog := &blogpb.Blog{
+		Id:        data.ID.Hex(),
+		AuthorId:  data.AuthorID,
+		Content:   data.Content,
+		Title:     data.Title,
+		Version:   data.Version,
+		Tags:      data.Tags,
+		Category:  data.Category,
+		CreatedAt: timestamppb.New(created),
+		UpdatedAt: timestamppb.New(updated),
+	}
+	if data.DeletedAt != nil {
+		blog.DeletedAt = timestamppb.New(*data.DeletedAt)
+	}
+	blog.Slug = data.Slug
+	blog.ContentFormat = contentFormats[data.ContentFormat]
+	for _, id := range data.AttachmentIDs {
+		blog.AttachmentIds = append(blog.AttachmentIds, id.Hex())
+	}
+	blog.Status = blogStatuses[data.status()]
+	if data.PublishAt != nil {
+		blog.PublishAt = timestamppb.New(*data.PublishAt)
+	}
+	return blog
+}
 
-	blog := req.GetBlog()
+// storeError maps a BlogStore error to a gRPC status error.
+func storeError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return status.Errorf(codes.NotFound, "Blog with id not found: %v\n", err)
+	}
+	if errors.Is(err, ErrCommentNotFound) {
+		return status.Errorf(codes.NotFound, "Comment with id not found: %v\n", err)
+	}
+	if errors.Is(err, ErrAuthorNotFound) {
+		return status.Errorf(codes.NotFound, "Author with id not found: %v\n", err)
+	}
+	if errors.Is(err, ErrAttachmentNotFound) {
+		return status.Errorf(codes.NotFound, "Attachment with id not found: %v\n", err)
+	}
+	if errors.Is(err, ErrAlreadyExists) {
+		return status.Errorf(codes.AlreadyExists, "Blog with id already exists: %v\n", err)
+	}
+	if errors.Is(err, ErrAuthorExists) {
+		return status.Errorf(codes.AlreadyExists, "Author with id already exists: %v\n", err)
+	}
+	if errors.Is(err, ErrSlugTaken) {
+		return status.Errorf(codes.AlreadyExists, "Blog slug already taken: %v\n", err)
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		return status.Errorf(codes.Aborted, "Blog was modified concurrently: %v\n", err)
+	}
+	if errors.Is(err, ErrInvalidResumeToken) {
+		return status.Errorf(codes.InvalidArgument, "Cannot parse resume token: %v\n", err)
+	}
+	if errors.Is(err, ErrResumeTokenExpired) {
+		return status.Errorf(codes.OutOfRange, "Cannot resume the watch: %v\n", err)
+	}
+	return status.Errorf(codes.Internal, "Internal error: %v\n", err)
+}
+
+func (s *server) CreateBlog(ctx context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
+	fmt.Println("CreateBlog invoked")
 
-	data := BlogItem{
-		AuthorID: blog.GetAuthorId(),
-		Content:  blog.GetContent(),
-		Title:    blog.GetTitle(),
+	if err := validate(req); err != nil {
+		return nil, err
 	}
 
-	res, err := Collection.InsertOne(ctx, data)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Internal error: %v\n", err))
+	if err := checkAuthor(ctx, s.store, "blog.author_id", req.GetBlog().GetAuthorId()); err != nil {
+		return nil, err
 	}
 
-	oid, ok := res.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Cannot convert to OID: %v\n", err))
+	data := newBlogItem(req.GetBlog())
+	if err := s.policy.Authorize(ctx, ActionCreate, &data); err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(ctx, s.store, 1, data.size()); err != nil {
+		return nil, err
+	}
+	created, err := createWithSlug(ctx, s.store, &data, slugify(data.Title))
+	if err != nil {
+		return nil, storeError(err)
 	}
 
 	return &blogpb.CreateBlogResponse{
-		Blog: &blogpb.Blog{
-			Id:       oid.Hex(),
-			AuthorId: blog.GetAuthorId(),
-			Content:  blog.GetContent(),
-			Title:    blog.GetTitle(),
-		},
+		Blog: dataToBlogPb(created),
 	}, nil
 }
 
-func (*server) ReadBlog(ctx context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
+// newBlogItem builds the item stored for a blog sent by a client.
+func newBlogItem(blog *blogpb.Blog) BlogItem {
+	createdAt := now()
+	status, publishAt := publication(blog.GetStatus(), blog.GetPublishAt(), createdAt)
+	return BlogItem{
+		AuthorID:  blog.GetAuthorId(),
+		Content:   blog.GetContent(),
+		Title:     blog.GetTitle(),
+		Tags:      normalizeTags(blog.GetTags()),
+		Category:  strings.TrimSpace(blog.GetCategory()),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Status:    status,
+		PublishAt: publishAt,
+
+		ContentFormat: formatFromPb(blog.GetContentFormat()),
+	}
+}
+
+func (s *server) ReadBlog(ctx context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
 	fmt.Println("ReadBlog invoked")
 
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
 	blogId := req.GetBlogId()
 	oid, err := primitive.ObjectIDFromHex(blogId)
 
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Cannot parse id: %v.\n", err))
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	data, err := readableBlog(ctx, s.store, s.policy, oid)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ReadBlogResponse{
+		Blog: renderedBlogPb(data, req.GetRender()),
+	}
+	if req.GetIncludeAuthor() {
+		if res.Author, err = blogAuthor(ctx, s.store, data); err != nil {
+			return nil, err
+		}
 	}
+	return res, nil
+
+}
+
+func (s *server) UpdateBlog(ctx context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
+	fmt.Println("UpdateBlog invoked")
 
-	// create an empty struct
-	data := &BlogItem{}
-	err = Collection.FindOne(context.TODO(), bson.D{{"_id", oid}}).Decode(data)
+	if err := validate(req); err != nil {
+		return nil, err
+	}
 
-	if err == mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog with id not found: %v\n", err))
+	data, err := s.updateBlog(ctx, s.store, "", req)
+	if err != nil {
+		return nil, err
 	}
 
-	return &blogpb.ReadBlogResponse{
-		Blog: &blogpb.Blog{
-			Id:       data.ID.Hex(),
-			AuthorId: data.AuthorID,
-			Content:  data.Content,
-			Title:    data.Title,
-		},
+	return &blogpb.UpdateBlogResponse{
+		Blog: dataToBlogPb(data),
 	}, nil
 
 }
 
-func (*server) UpdateBlog(ctx context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
-	fmt.Println("UpdateBlog invoked")
+// updateBlog applies an UpdateBlog request, found at prefix in a batch, to
+// store and returns a gRPC status error when it fails.
+func (s *server) updateBlog(ctx context.Context, store BlogStore, prefix string, req *blogpb.UpdateBlogRequest) (*BlogItem, error) {
 	blog := req.GetBlog()
 
 	oid, err := primitive.ObjectIDFromHex(blog.GetId())
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Cannot parse id: %v.\n", err))
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+
+	update, err := blogUpdate(blog, req.GetUpdateMask())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid update mask: %v\n", err)
+	}
+	update.IfVersion = req.GetExpectedVersion()
+	update.UpdatedAt = now()
+
+	current, err := s.authorizeBlog(ctx, store, ActionUpdate, oid)
+	if status.Code(err) == codes.NotFound && req.GetAllowMissing() {
+		// authorized as a creation below
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		next, err := s.authorizeChange(ctx, current, update)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkQuota(ctx, store, 0, next.size()-current.size()); err != nil {
+			return nil, err
+		}
+	}
+
+	authorField := fieldPath(prefix, "blog.author_id")
+	if update.AuthorID != nil {
+		if err := checkAuthor(ctx, store, authorField, *update.AuthorID); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := updateWithHistory(ctx, store, oid, update)
+	if errors.Is(err, ErrNotFound) && req.GetAllowMissing() {
+		if update.AuthorID == nil {
+			if err := checkAuthor(ctx, store, authorField, blog.GetAuthorId()); err != nil {
+				return nil, err
+			}
+		}
+		item := newBlogItem(blog)
+		if err := s.policy.Authorize(ctx, ActionCreate, &item); err != nil {
+			return nil, err
+		}
+		if err := s.checkQuota(ctx, store, 1, item.size()); err != nil {
+			return nil, err
+		}
+		item.ID = oid
+		if blog.GetCreatedAt() != nil {
+			item.CreatedAt = blog.GetCreatedAt().AsTime().Truncate(time.Millisecond)
+		}
+		// an imported blog keeps its slug when it is free
+		base := blog.GetSlug()
+		if base == "" {
+			base = item.Title
+		}
+		data, err = createWithSlug(ctx, store, &item, slugify(base))
+	}
+	if err != nil {
+		return nil, storeError(err)
 	}
+	return data, nil
+}
 
-	data := BlogItem{}
+// authorizeChange returns current with update applied, checking that the
+// caller, already allowed to update current, may hand the blog over to
+// another author: that takes being allowed to change it as that author too.
+func (s *server) authorizeChange(ctx context.Context, current *BlogItem, update BlogUpdate) (BlogItem, error) {
+	next := *current
+	update.apply(&next)
+	if next.AuthorID != current.AuthorID {
+		if err := s.policy.Authorize(ctx, ActionUpdate, &next); err != nil {
+			return next, err
+		}
+	}
+	return next, nil
+}
 
-	err = Collection.FindOne(context.TODO(), bson.D{{"_id", oid}}).Decode(data)
+// blogUpdate picks the fields of blog named by mask, or all of them when
+// the mask is empty.
+func blogUpdate(blog *blogpb.Blog, mask *fieldmaskpb.FieldMask) (BlogUpdate, error) {
+	authorID, title, content := blog.GetAuthorId(), blog.GetTitle(), blog.GetContent()
+	tags, category := normalizeTags(blog.GetTags()), strings.TrimSpace(blog.GetCategory())
+	format := formatFromPb(blog.GetContentFormat())
 
-	if err == mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog with id not found: %v\n", err))
+	paths := mask.GetPaths()
+	if len(paths) == 0 {
+		return BlogUpdate{AuthorID: &authorID, Title: &title, Content: &content, Tags: &tags, Category: &category, ContentFormat: &format}, nil
 	}
 
-	// updating...
-	data.AuthorID = blog.GetAuthorId()
-	data.Content = blog.GetContent()
-	data.Title = blog.GetTitle()
-	data.ID = oid
+	var u BlogUpdate
+	for _, path := range paths {
+		switch path {
+		case "author_id":
+			u.AuthorID = &authorID
+		case "title":
+			u.Title = &title
+		case "content":
+			u.Content = &content
+		case "tags":
+			u.Tags = &tags
+		case "category":
+			u.Category = &category
+		case "content_format":
+			u.ContentFormat = &format
+		default:
+			return u, fmt.Errorf("unknown or read-only path %q", path)
+		}
+	}
+	return u, nil
+}
 
-	filter := bson.D{{"_id", oid}}
+func (s *server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
+	fmt.Println("DeleteBlog invoked")
 
-	_, err = Collection.ReplaceOne(context.TODO(), filter, data)
+	if err := validate(req); err != nil {
+		return nil, err
+	}
 
+	data, err := s.deleteBlog(ctx, s.store, req)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Cannot update object in MongoDB: %v\n", err))
+		return nil, err
 	}
 
-	return &blogpb.UpdateBlogResponse{
-		Blog: &blogpb.Blog{
-			Id:       data.ID.Hex(),
-			AuthorId: data.AuthorID,
-			Content:  data.Content,
-			Title:    data.Title,
-		},
+	return &blogpb.DeleteBlogResponse{
+		BlogId: data.ID.Hex(),
 	}, nil
 
 }
 
-func (*server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
-	fmt.Println("DeleteBlog invoked")
-
-	blogId := req.GetBlogId()
+// deleteBlog moves the blog of a DeleteBlog request to the trash of store
+// and returns a gRPC status error when it fails.
+func (s *server) deleteBlog(ctx context.Context, store BlogStore, req *blogpb.DeleteBlogRequest) (*BlogItem, error) {
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
+	if _, err := s.authorizeBlog(ctx, store, ActionDelete, oid); err != nil {
+		return nil, err
+	}
 
-	oid, err := primitive.ObjectIDFromHex(blogId)
+	deleted := true
+	data, err := store.Update(ctx, oid, BlogUpdate{
+		Deleted:   &deleted,
+		UpdatedAt: now(),
+		IfVersion: req.GetExpectedVersion(),
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Cannot parse id: %v.\n", err))
+		return nil, storeError(err)
 	}
+	return data, nil
+}
 
-	data := BlogItem{}
-	err = Collection.FindOne(context.TODO(), bson.D{{"_id", oid}}).Decode(data)
+func (s *server) UndeleteBlog(ctx context.Context, req *blogpb.UndeleteBlogRequest) (*blogpb.UndeleteBlogResponse, error) {
+	fmt.Println("UndeleteBlog invoked")
 
-	if err == mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog with id not found: %v\n", err))
+	if err := validate(req); err != nil {
+		return nil, err
 	}
 
-	filter := bson.D{{"_id", oid}}
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot parse id: %v.\n", err)
+	}
 
-	_, err = Collection.DeleteOne(context.TODO(), filter)
+	if _, err := s.authorizeBlog(ctx, s.store, ActionDelete, oid); err != nil {
+		return nil, err
+	}
 
+	deleted := false
+	data, err := s.store.Update(ctx, oid, BlogUpdate{
+		Deleted:   &deleted,
+		UpdatedAt: now(),
+		IfVersion: req.GetExpectedVersion(),
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Cannot delete from MongoDB: %v\n", err))
+		return nil, storeError(err)
 	}
 
-	return &blogpb.DeleteBlogResponse{
-		BlogId: oid.Hex(),
+	return &blogpb.UndeleteBlogResponse{
+		Blog: dataToBlogPb(data),
 	}, nil
-
 }
 
-func (*server) ListBlog(req *blogpb.ListBlogRequest, stream blogpb.BlogService_ListBlogServer) error {
+func (s *server) ListBlog(req *blogpb.ListBlogRequest, stream blogpb.BlogService_ListBlogServer) error {
 	fmt.Println("ListAllBlog invoked")
 
-	filter := bson.D{}
+	if err := validate(req); err != nil {
+		return err
+	}
 
-	cur, err := Collection.Find(context.TODO(), filter)
+	opts, err := listOptions(req)
 	if err != nil {
-		return status.Errorf(codes.Internal, fmt.Sprintf("Uknown internal err: %v\n", err))
+		return status.Errorf(codes.InvalidArgument, "Invalid list request: %v\n", err)
+	}
+	ctx := stream.Context()
+	if readerID, all := s.policy.ReadScope(ctx); !all {
+		opts.ReaderID = &readerID
+	}
+	size := opts.Limit
+	batchSize := int(req.GetBatchSize())
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if batchSize > size {
+		batchSize = size
+	}
+	pace := newPacer(streamRate(req.GetMaxRate(), s.maxListRate))
+
+	// Fetch one extra blog to learn whether another page follows. A full
+	// batch is held back until the next blog arrives so its resume token is
+	// only set when there is something left to resume.
+	var batch []BlogItem
+	var sendErr error
+	listed, extra := 0, false
+	send := func(more bool) error {
+		if err := pace.wait(ctx, len(batch)); err != nil {
+			return err
+		}
+		res := &blogpb.ListBlogResponse{}
+		if req.GetBatchSize() > 1 {
+			for i := range batch {
+				res.Blogs = append(res.Blogs, renderedBlogPb(&batch[i], req.GetRender()))
+			}
+		} else {
+			res.Blog = renderedBlogPb(&batch[0], req.GetRender())
+		}
+		if more {
+			res.NextPageToken = encodePageToken(newPageToken(&batch[len(batch)-1], opts))
+		}
+		batch = batch[:0]
+		sendErr = stream.Send(res)
+		return sendErr
 	}
-	defer cur.Close(context.Background())
 
-	for cur.Next(context.Background()) {
-		data := &BlogItem{}
-		err := cur.Decode(data)
-		if err != nil {
-			return status.Errorf(codes.Internal, fmt.Sprintf("Err while decoding data: %v\n", err))
+	opts.Limit = size + 1
+	err = s.store.List(ctx, opts, func(data *BlogItem) error {
+		if len(batch) == batchSize {
+			if err := send(true); err != nil {
+				return err
+			}
+		}
+		if listed == size {
+			// the extra blog, only there to tell the page is not the last
+			extra = true
+			return nil
 		}
+		batch = append(batch, *data)
+		listed++
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = send(extra)
+	}
+	switch {
+	case ctx.Err() != nil:
+		// the client went away
+		return status.FromContextError(ctx.Err()).Err()
+	case sendErr != nil:
+		return sendErr
+	case err != nil:
+		return status.Errorf(codes.Internal, "Uknown internal err: %v\n", err)
+	}
+	return nil
+}
+
+func (s *server) SearchBlogs(ctx context.Context, req *blogpb.SearchBlogsRequest) (*blogpb.SearchBlogsResponse, error) {
+	fmt.Println("SearchBlogs invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	terms := make(map[string]bool)
+	for _, t := range tokenize(req.GetQuery()) {
+		terms[t] = true
+	}
+	if len(terms) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Search query has no words\n")
+	}
 
-		stream.Send(&blogpb.ListBlogResponse{
-			Blog: &blogpb.Blog{
-				Id:       data.ID.Hex(),
-				AuthorId: data.AuthorID,
-				Content:  data.Content,
-				Title:    data.Title,
-			},
+	pre, post := req.GetHighlightPreTag(), req.GetHighlightPostTag()
+	if pre == "" && post == "" {
+		pre, post = "<em>", "</em>"
+	}
+
+	hits, err := s.store.Search(ctx, TenantFromContext(ctx), req.GetQuery(), pageSize(req.GetLimit()))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.SearchBlogsResponse{}
+	for _, hit := range hits {
+		res.Results = append(res.Results, &blogpb.SearchResult{
+			Blog:           dataToBlogPb(hit.Item),
+			Score:          hit.Score,
+			TitleSnippet:   highlight(hit.Item.Title, terms, pre, post, 0),
+			ContentSnippet: highlight(hit.Item.Content, terms, pre, post, snippetLength),
 		})
-		time.Sleep(1 * time.Second)
 	}
-	if err := cur.Err(); err != nil {
-		return status.Errorf(codes.Internal, fmt.Sprintf("Error final step: %v\n", err))
+	return res, nil
+}
+
+var eventTypes = map[EventType]blogpb.WatchBlogsResponse_EventType{
+	EventCreated:   blogpb.WatchBlogsResponse_CREATED,
+	EventUpdated:   blogpb.WatchBlogsResponse_UPDATED,
+	EventDeleted:   blogpb.WatchBlogsResponse_DELETED,
+	EventUndeleted: blogpb.WatchBlogsResponse_UNDELETED,
+	EventPurged:    blogpb.WatchBlogsResponse_PURGED,
+}
+
+func (s *server) WatchBlogs(req *blogpb.WatchBlogsRequest, stream blogpb.BlogService_WatchBlogsServer) error {
+	fmt.Println("WatchBlogs invoked")
+
+	if err := validate(req); err != nil {
+		return err
 	}
 
+	opts := WatchOptions{
+		AuthorID:    req.GetAuthorId(),
+		ResumeToken: req.GetResumeToken(),
+	}
+	err := s.store.Watch(stream.Context(), opts, func(ev *BlogEvent) error {
+		res := &blogpb.WatchBlogsResponse{
+			Type:        eventTypes[ev.Type],
+			BlogId:      ev.BlogID.Hex(),
+			ResumeToken: ev.ResumeToken,
+		}
+		if ev.Blog != nil {
+			res.Blog = dataToBlogPb(ev.Blog)
+		}
+		return stream.Send(res)
+	})
+	if stream.Context().Err() != nil {
+		// the client went away
+		return status.FromContextError(stream.Context().Err()).Err()
+	}
+	if err != nil {
+		return storeError(err)
+	}
 	return nil
 }
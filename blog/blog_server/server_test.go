@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// newTestServer returns a server over a memory store scoped to tenants, with
+// ann and bob registered as authors, and the store itself.
+func newTestServer(t *testing.T, policy Policy, quotas Quotas) (*server, BlogStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	mustCreateAuthors(t, store, "", "ann", "bob")
+	attachments, err := NewDirAttachmentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(NewTenantStore(store), attachments, 1<<20, policy, quotas, 0), store
+}
+
+// mustCreateAuthors registers the authors with the given ids in tenant.
+func mustCreateAuthors(t *testing.T, store BlogStore, tenant string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if _, err := store.CreateAuthor(context.Background(), &AuthorItem{ID: id, Tenant: tenant, DisplayName: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// callerContext returns the context of a request by subject with roles.
+func callerContext(subject string, roles ...string) context.Context {
+	return ContextWithIdentity(context.Background(), &Identity{Subject: subject, Roles: roles})
+}
+
+// mustCreateBlog creates a published blog by author through the server.
+func mustCreateBlog(t *testing.T, s *server, ctx context.Context, author, title string) *blogpb.Blog {
+	t.Helper()
+	res, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{
+		Blog: &blogpb.Blog{AuthorId: author, Title: title, Content: "content of " + title, Status: blogpb.Blog_PUBLISHED},
+	})
+	if err != nil {
+		t.Fatalf("CreateBlog(%q): %v", title, err)
+	}
+	return res.GetBlog()
+}
+
+func TestBlogUpdate(t *testing.T) {
+	blog := &blogpb.Blog{AuthorId: "ann", Title: "Title", Content: "Content", Tags: []string{" Go", "go"}, Category: " news ", ContentFormat: blogpb.Blog_MARKDOWN}
+	author, title, content := "ann", "Title", "Content"
+	tags, category, format := []string{"go"}, "news", FormatMarkdown
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    BlogUpdate
+		wantErr bool
+	}{
+		{"no mask", nil, BlogUpdate{AuthorID: &author, Title: &title, Content: &content, Tags: &tags, Category: &category, ContentFormat: &format}, false},
+		{"title", []string{"title"}, BlogUpdate{Title: &title}, false},
+		{"title and content", []string{"title", "content"}, BlogUpdate{Title: &title, Content: &content}, false},
+		{"tags", []string{"tags"}, BlogUpdate{Tags: &tags}, false},
+		{"content format", []string{"content_format"}, BlogUpdate{ContentFormat: &format}, false},
+		{"read-only path", []string{"id"}, BlogUpdate{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mask *fieldmaskpb.FieldMask
+			if tt.paths != nil {
+				mask = &fieldmaskpb.FieldMask{Paths: tt.paths}
+			}
+			got, err := blogUpdate(blog, mask)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("blogUpdate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("blogUpdate: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blogUpdate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
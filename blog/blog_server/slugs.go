@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxSlugLength is the number of runes a slug is cut to, before any
+	// collision suffix.
+	maxSlugLength = 80
+	// maxSlugSuffix is the highest "-n" suffix tried on a colliding slug
+	// before falling back to the blog id.
+	maxSlugSuffix = 50
+	// defaultSlug names blogs whose title has no letters or digits.
+	defaultSlug = "blog"
+)
+
+// slugify turns text into lower-case words of letters and digits joined by
+// dashes, with accents removed.
+func slugify(text string) string {
+	var b strings.Builder
+	dash := false
+	n := 0
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			// a combining accent left over by the decomposition
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			dash = true
+			continue
+		}
+		// the dash joining two words counts too
+		width := 1
+		if dash && b.Len() > 0 {
+			width = 2
+		}
+		if n+width > maxSlugLength {
+			break
+		}
+		if width == 2 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteRune(unicode.ToLower(r))
+		n += width
+	}
+	if b.Len() == 0 {
+		return defaultSlug
+	}
+	return b.String()
+}
+
+func hasSlug(slugs []string, slug string) bool {
+	for _, s := range slugs {
+		if s == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueSlug returns the first of base, base-2, base-3... that is free or
+// already belongs to the blog with the given id and is not in reserved.
+func uniqueSlug(ctx context.Context, store BlogStore, base string, id primitive.ObjectID, reserved map[string]bool) (string, error) {
+	for n := 1; n <= maxSlugSuffix; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		if reserved[slug] {
+			continue
+		}
+
+		owner, err := store.GetBySlug(ctx, TenantFromContext(ctx), slug)
+		if errors.Is(err, ErrNotFound) || (err == nil && owner.ID == id && !id.IsZero()) {
+			return slug, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+	}
+	return base + "-" + id.Hex(), nil
+}
+
+// createWithSlug stores item under a unique slug derived from base, trying
+// again when another writer takes the slug first.
+func createWithSlug(ctx context.Context, store BlogStore, item *BlogItem, base string) (*BlogItem, error) {
+	for attempt := 1; ; attempt++ {
+		slug, err := uniqueSlug(ctx, store, base, item.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		item.Slug, item.Slugs = slug, []string{slug}
+
+		created, err := store.Create(ctx, item)
+		if errors.Is(err, ErrSlugTaken) && attempt < maxUpdateAttempts {
+			continue
+		}
+		return created, err
+	}
+}
+
+// assignSlugs gives each of items a slug derived from its title that is
+// unique in the store and among items.
+func assignSlugs(ctx context.Context, store BlogStore, items []BlogItem) error {
+	reserved := make(map[string]bool)
+	for i := range items {
+		slug, err := uniqueSlug(ctx, store, slugify(items[i].Title), items[i].ID, reserved)
+		if err != nil {
+			return err
+		}
+		reserved[slug] = true
+		items[i].Slug, items[i].Slugs = slug, []string{slug}
+	}
+	return nil
+}
+
+// backfillSlugs gives a slug to the live blogs stored before slugs existed.
+func backfillSlugs(ctx context.Context, store BlogStore) error {
+	var missing []BlogItem
+	err := store.List(ctx, ListOptions{}, func(item *BlogItem) error {
+		if item.Slug == "" {
+			missing = append(missing, *item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range missing {
+		// slugs are unique per tenant
+		ctx := ContextWithTenant(ctx, item.Tenant)
+		for attempt := 1; ; attempt++ {
+			slug, err := uniqueSlug(ctx, store, slugify(item.Title), item.ID, nil)
+			if err != nil {
+				return err
+			}
+			_, err = store.Update(ctx, item.ID, BlogUpdate{Slug: &slug})
+			if errors.Is(err, ErrSlugTaken) && attempt < maxUpdateAttempts {
+				continue
+			}
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			break
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("Gave slugs to %d blogs\n", len(missing))
+	}
+	return nil
+}
+
+func (s *server) ReadBlogBySlug(ctx context.Context, req *blogpb.ReadBlogBySlugRequest) (*blogpb.ReadBlogBySlugResponse, error) {
+	fmt.Println("ReadBlogBySlug invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	if req.GetSlug() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Slug is empty\n")
+	}
+
+	data, err := s.store.GetBySlug(ctx, TenantFromContext(ctx), req.GetSlug())
+	if err == nil && (data.DeletedAt != nil || !canRead(ctx, s.policy, data)) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ReadBlogBySlugResponse{
+		Blog:          renderedBlogPb(data, req.GetRender()),
+		CanonicalSlug: data.Slug,
+	}
+	if req.GetIncludeAuthor() {
+		if res.Author, err = blogAuthor(ctx, s.store, data); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Crème brûlée à la carte", "creme-brulee-a-la-carte"},
+		{"Go 1.16 released", "go-1-16-released"},
+		{"Привет мир", "привет-мир"},
+		{"!!!", defaultSlug},
+		{"", defaultSlug},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.text); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSlugifyLength(t *testing.T) {
+	got := slugify(strings.Repeat("word ", 100))
+	if n := utf8.RuneCountInString(got); n > maxSlugLength {
+		t.Errorf("slugify of a long title has %d runes, want at most %d", n, maxSlugLength)
+	}
+	if strings.HasSuffix(got, "-") {
+		t.Errorf("slugify of a long title = %q, ends with a dash", got)
+	}
+}
+
+func TestBlogSlugs(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	ctx := context.Background()
+	first := mustCreateBlog(t, s, ctx, "ann", "Hello World")
+	second := mustCreateBlog(t, s, ctx, "ann", "Hello, world!")
+	if first.GetSlug() != "hello-world" || second.GetSlug() != "hello-world-2" {
+		t.Fatalf("slugs = %q and %q, want hello-world and hello-world-2", first.GetSlug(), second.GetSlug())
+	}
+
+	updated, err := s.UpdateBlog(ctx, &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: first.GetId(), AuthorId: "ann", Title: "Renamed"}})
+	if err != nil {
+		t.Fatalf("UpdateBlog: %v", err)
+	}
+	if got := updated.GetBlog().GetSlug(); got != "renamed" {
+		t.Errorf("slug after a new title = %q, want renamed", got)
+	}
+	for _, slug := range []string{"hello-world", "renamed"} {
+		read, err := s.ReadBlogBySlug(ctx, &blogpb.ReadBlogBySlugRequest{Slug: slug})
+		if err != nil || read.GetBlog().GetId() != first.GetId() {
+			t.Errorf("ReadBlogBySlug(%q) = %v, %v, want the renamed blog", slug, read.GetBlog(), err)
+		}
+	}
+
+	// the old slug stays with the blog that had it
+	third := mustCreateBlog(t, s, ctx, "ann", "Hello World")
+	if third.GetSlug() != "hello-world-3" {
+		t.Errorf("slug of a title once used = %q, want hello-world-3", third.GetSlug())
+	}
+}
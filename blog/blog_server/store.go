@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned by a BlogStore when no blog matches the given id.
+	ErrNotFound = errors.New("blog not found")
+	// ErrCommentNotFound is returned by a BlogStore when no comment matches
+	// the given id.
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrAuthorNotFound is returned by a BlogStore when no author matches
+	// the given id.
+	ErrAuthorNotFound = errors.New("author not found")
+	// ErrAuthorExists is returned by CreateAuthor when the given id is taken.
+	ErrAuthorExists = errors.New("author already exists")
+	// ErrAlreadyExists is returned by Create when the given ID is taken.
+	ErrAlreadyExists = errors.New("blog already exists")
+	// ErrSlugTaken is returned by a write giving a blog a slug that another
+	// blog has or had.
+	ErrSlugTaken = errors.New("slug already taken")
+	// ErrVersionMismatch is returned by a conditional write when the stored
+	// blog no longer has the expected version.
+	ErrVersionMismatch = errors.New("blog version mismatch")
+	// ErrInvalidResumeToken is returned by Watch for a malformed token.
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrResumeTokenExpired is returned by Watch when the events following
+	// the token are no longer available.
+	ErrResumeTokenExpired = errors.New("resume token expired")
+)
+
+type BlogItem struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	AuthorID string             `bson:"author_id"`
+	Content  string             `bson:"content"`
+	Title    string             `bson:"title"`
+	Version  int64              `bson:"version"`
+	Tags     []string           `bson:"tags,omitempty"`
+	Category string             `bson:"category,omitempty"`
+	// CreatedAt and UpdatedAt are missing from blogs stored before they
+	// were recorded, see timestamps.
+	CreatedAt time.Time `bson:"created_at,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty"`
+	// DeletedAt is set while the blog is in the trash.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	// Status is missing from blogs stored before it was recorded, see
+	// status.
+	Status    BlogStatus `bson:"status,omitempty"`
+	PublishAt *time.Time `bson:"publish_at,omitempty"`
+	// Slug is the current slug and Slugs every slug the blog ever had,
+	// Slug included, so old links keep working.
+	Slug  string   `bson:"slug,omitempty"`
+	Slugs []string `bson:"slugs,omitempty"`
+	// ContentFormat is missing from plain text blogs.
+	ContentFormat ContentFormat `bson:"content_format,omitempty"`
+	// AttachmentIDs lists the attachments uploaded to the blog, oldest
+	// first.
+	AttachmentIDs []primitive.ObjectID `bson:"attachment_ids,omitempty"`
+	// Tenant is the namespace the blog belongs to, missing for the default
+	// one. It never changes.
+	Tenant string `bson:"tenant,omitempty"`
+}
+
+// size is what the blog counts for in the storage quota of its tenant.
+func (item *BlogItem) size() int64 {
+	return int64(len(item.Title) + len(item.Content))
+}
+
+// TenantUsage is what the blogs of a tenant take up, those in the trash
+// included.
+type TenantUsage struct {
+	Blogs int64 `bson:"blogs"`
+	// Bytes sums the size of the blogs.
+	Bytes int64 `bson:"bytes"`
+}
+
+// ContentFormat is the markup the content of a blog is written in.
+type ContentFormat string
+
+const (
+	// FormatPlain is empty so blogs stored before formats existed are
+	// plain text.
+	FormatPlain    ContentFormat = ""
+	FormatMarkdown ContentFormat = "markdown"
+	FormatHTML     ContentFormat = "html"
+)
+
+// BlogStatus is where a blog stands in the publishing workflow.
+type BlogStatus string
+
+const (
+	StatusDraft     BlogStatus = "draft"
+	StatusScheduled BlogStatus = "scheduled"
+	StatusPublished BlogStatus = "published"
+	StatusArchived  BlogStatus = "archived"
+)
+
+// status returns the status of item, blogs stored without one having been
+// public all along.
+func (item *BlogItem) status() BlogStatus {
+	if item.Status == "" {
+		return StatusPublished
+	}
+	return item.Status
+}
+
+func hasStatus(statuses []BlogStatus, status BlogStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// timestamps returns when item was created and last updated, falling back
+// to the creation time held in its ID for blogs stored without them.
+func (item *BlogItem) timestamps() (created, updated time.Time) {
+	created, updated = item.CreatedAt, item.UpdatedAt
+	if created.IsZero() {
+		created = item.ID.Timestamp()
+	}
+	if updated.IsZero() {
+		updated = created
+	}
+	return created, updated
+}
+
+// Revision is a past state of a blog, recorded before an update replaced it.
+type Revision struct {
+	BlogID  primitive.ObjectID `bson:"blog_id"`
+	Version int64              `bson:"version"`
+	Blog    BlogItem           `bson:"blog"`
+}
+
+// CommentItem is a comment on a blog, possibly replying to another comment.
+type CommentItem struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	BlogID   primitive.ObjectID `bson:"blog_id"`
+	ParentID primitive.ObjectID `bson:"parent_id,omitempty"`
+	// Ancestors holds the ids of the comments this one replies to, directly
+	// or not, the top-level comment first. It lets a comment be deleted
+	// together with all its replies.
+	Ancestors []primitive.ObjectID `bson:"ancestors,omitempty"`
+	AuthorID  string               `bson:"author_id"`
+	Content   string               `bson:"content"`
+	CreatedAt time.Time            `bson:"created_at"`
+}
+
+// AuthorItem is a writer of blogs, keyed within its tenant by the handle
+// blogs carry as their AuthorID.
+type AuthorItem struct {
+	ID string `bson:"id"`
+	// Tenant is the namespace the author writes in, missing for the default
+	// one.
+	Tenant      string    `bson:"tenant,omitempty"`
+	DisplayName string    `bson:"display_name"`
+	Bio         string    `bson:"bio,omitempty"`
+	Email       string    `bson:"email,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// AuthorUpdate lists the fields an UpdateAuthor writes, nil fields are left
+// as they are.
+type AuthorUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Email       *string
+
+	// UpdatedAt is always written.
+	UpdatedAt time.Time
+}
+
+// apply writes the fields set in u to a.
+func (u *AuthorUpdate) apply(a *AuthorItem) {
+	if u.DisplayName != nil {
+		a.DisplayName = *u.DisplayName
+	}
+	if u.Bio != nil {
+		a.Bio = *u.Bio
+	}
+	if u.Email != nil {
+		a.Email = *u.Email
+	}
+	a.UpdatedAt = u.UpdatedAt
+}
+
+// BlogUpdate lists the fields an Update writes, nil fields are left as they
+// are.
+type BlogUpdate struct {
+	AuthorID *string
+	Title    *string
+	Content  *string
+	Tags     *[]string
+	Category *string
+	// ContentFormat changes how Content is rendered.
+	ContentFormat *ContentFormat
+
+	// UpdatedAt is always written when it is non-zero.
+	UpdatedAt time.Time
+
+	// Status changes the publishing status when set, PublishAt being
+	// written along with it and nil clearing it.
+	Status    *BlogStatus
+	PublishAt *time.Time
+
+	// Slug replaces the current slug when set, keeping it among the old ones.
+	Slug *string
+
+	// Attachment is appended to AttachmentIDs when set.
+	Attachment *primitive.ObjectID
+
+	// Deleted moves the blog to the trash when true, stamping DeletedAt with
+	// UpdatedAt, and restores it when false. An update only applies to blogs
+	// in the trash when it restores them.
+	Deleted *bool
+
+	// IfVersion makes the update conditional on the stored version when it
+	// is non-zero.
+	IfVersion int64
+}
+
+// apply writes the fields set in u to item.
+func (u *BlogUpdate) apply(item *BlogItem) {
+	if u.AuthorID != nil {
+		item.AuthorID = *u.AuthorID
+	}
+	if u.Title != nil {
+		item.Title = *u.Title
+	}
+	if u.Content != nil {
+		item.Content = *u.Content
+	}
+	if u.Tags != nil {
+		item.Tags = *u.Tags
+	}
+	if u.Category != nil {
+		item.Category = *u.Category
+	}
+	if u.ContentFormat != nil {
+		item.ContentFormat = *u.ContentFormat
+	}
+	if !u.UpdatedAt.IsZero() {
+		item.UpdatedAt = u.UpdatedAt
+	}
+	if u.Status != nil {
+		item.Status = *u.Status
+		item.PublishAt = u.PublishAt
+	}
+	if u.Slug != nil {
+		item.Slug = *u.Slug
+		if !hasSlug(item.Slugs, *u.Slug) {
+			item.Slugs = append(append([]string(nil), item.Slugs...), *u.Slug)
+		}
+	}
+	if u.Attachment != nil {
+		item.AttachmentIDs = append(append([]primitive.ObjectID(nil), item.AttachmentIDs...), *u.Attachment)
+	}
+	if u.Deleted != nil {
+		item.DeletedAt = nil
+		if *u.Deleted {
+			deletedAt := u.UpdatedAt
+			item.DeletedAt = &deletedAt
+		}
+	}
+}
+
+// eventType is the kind of change applying u makes.
+func (u *BlogUpdate) eventType() EventType {
+	switch {
+	case u.Deleted == nil:
+		return EventUpdated
+	case *u.Deleted:
+		return EventDeleted
+	default:
+		return EventUndeleted
+	}
+}
+
+// appliesTo reports whether u may be applied to item given whether it is in
+// the trash.
+func (u *BlogUpdate) appliesTo(item *BlogItem) bool {
+	restore := u.Deleted != nil && !*u.Deleted
+	return (item.DeletedAt != nil) == restore
+}
+
+func (item *BlogItem) cursor() Cursor {
+	created, updated := item.timestamps()
+	return Cursor{ID: item.ID, Title: item.Title, CreatedAt: created, UpdatedAt: updated}
+}
+
+// SortField is the key a BlogStore listing is ordered by. Ties are always
+// broken by ID so the order is total.
+type SortField int
+
+const (
+	// SortByCreated orders blogs by CreatedAt.
+	SortByCreated SortField = iota
+	SortByTitle
+	SortByUpdated
+)
+
+// Cursor is the position of the last blog of a previous listing.
+type Cursor struct {
+	ID        primitive.ObjectID
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeletedFilter selects which blogs a listing returns by trash state.
+type DeletedFilter int
+
+const (
+	ExcludeDeleted DeletedFilter = iota
+	IncludeDeleted
+	OnlyDeleted
+)
+
+// ListOptions narrows and orders a BlogStore listing.
+type ListOptions struct {
+	// Tenant only keeps the blogs of this tenant when it is set, every
+	// tenant being listed otherwise.
+	Tenant  *string
+	Deleted DeletedFilter
+
+	AuthorID      string
+	TitlePrefix   string
+	TitleContains string
+	// CreatedAfter and CreatedBefore bound the creation time, inclusive and
+	// exclusive respectively, when they are non-zero.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Tags keeps blogs with any of them, or all of them when AllTags is set.
+	Tags     []string
+	AllTags  bool
+	Category string
+	// Statuses keeps blogs with one of them when it is not empty.
+	Statuses []BlogStatus
+	// ReaderID, when set, only keeps the blogs that are not published when
+	// their author is the reader with this id, none when it is empty.
+	ReaderID *string
+
+	SortBy     SortField
+	Descending bool
+
+	// After resumes the listing right past this position when it is set.
+	After *Cursor
+	// Limit caps the number of blogs listed, zero means no limit.
+	Limit int
+}
+
+// EventType is the kind of change a BlogEvent reports.
+type EventType int
+
+const (
+	EventCreated EventType = iota + 1
+	EventUpdated
+	EventDeleted
+	EventUndeleted
+	EventPurged
+)
+
+// BlogEvent is a change to a blog streamed by Watch.
+type BlogEvent struct {
+	Type   EventType
+	BlogID primitive.ObjectID
+	// Blog is the blog after the change, nil for EventPurged.
+	Blog *BlogItem
+	// Tenant is the tenant of the blog, which EventPurged carries too.
+	Tenant string
+	// ResumeToken resumes a watch right after this event.
+	ResumeToken string
+}
+
+// WatchOptions narrows the events streamed by Watch.
+type WatchOptions struct {
+	// AuthorID only keeps events about blogs of this author, plus purges
+	// which no longer know the author.
+	AuthorID string
+	// ResumeToken starts the watch right after the event it came from.
+	ResumeToken string
+}
+
+func (opts *WatchOptions) matches(ev *BlogEvent) bool {
+	return opts.AuthorID == "" || ev.Blog == nil || ev.Blog.AuthorID == opts.AuthorID
+}
+
+// BlogStore is the persistence layer used by the BlogService server.
+type BlogStore interface {
+	// Create stores a new blog and returns it with version 1 and its ID,
+	// generated unless item has one. It fails with ErrAlreadyExists when the
+	// ID is taken, also by a blog in the trash, or ErrSlugTaken.
+	Create(ctx context.Context, item *BlogItem) (*BlogItem, error)
+	// CreateMany stores new blogs in one go, like Create. The blogs and
+	// errors returned line up with items, a nil error meaning the blog was
+	// created.
+	CreateMany(ctx context.Context, items []BlogItem) ([]BlogItem, []error)
+	// Get returns the blog with the given id, even from the trash, or
+	// ErrNotFound.
+	Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error)
+	// GetMany returns the blogs with the given ids in one go, even from the
+	// trash, lined up with ids and nil for those not found.
+	GetMany(ctx context.Context, ids []primitive.ObjectID) ([]*BlogItem, error)
+	// GetBySlug returns the blog of tenant that has or had the given slug,
+	// even from the trash, or ErrNotFound. Slugs are unique per tenant.
+	GetBySlug(ctx context.Context, tenant, slug string) (*BlogItem, error)
+	// Replace overwrites the blog with the same ID or returns ErrNotFound.
+	Replace(ctx context.Context, item *BlogItem) error
+	// Update writes the fields set in u to the blog with the given id, bumps
+	// its version and returns the result. It fails with ErrNotFound, also
+	// when the blog's trash state does not allow u, ErrVersionMismatch or
+	// ErrSlugTaken.
+	Update(ctx context.Context, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error)
+	// UpdateMany applies updates[i] to the blog ids[i] like Update, in one
+	// go. Every update must set IfVersion, and ids must not repeat. The
+	// blogs and errors returned line up with ids, a nil error meaning the
+	// blog was updated.
+	UpdateMany(ctx context.Context, ids []primitive.ObjectID, updates []BlogUpdate) ([]BlogItem, []error)
+	// Delete permanently removes the blog with the given id, its revisions
+	// and its comments. When ifVersion is non-zero the blog must still have
+	// that version. It fails with ErrNotFound or ErrVersionMismatch.
+	Delete(ctx context.Context, id primitive.ObjectID, ifVersion int64) error
+	// Purge permanently removes the blogs moved to the trash before
+	// deletedBefore, with their revisions and comments, and returns them with
+	// at least their ID, Tenant and AttachmentIDs set, so that their
+	// attachments can go too.
+	Purge(ctx context.Context, deletedBefore time.Time) ([]BlogItem, error)
+	// List calls fn for every blog matching opts, stopping at the first error.
+	List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error
+	// CountTags returns how many published blogs of tenant outside the
+	// trash, of the given category when it is not empty, carry each tag,
+	// most used first.
+	CountTags(ctx context.Context, tenant, category string) ([]TagCount, error)
+	// Search returns up to limit published blogs of tenant outside the
+	// trash matching query, most relevant first.
+	Search(ctx context.Context, tenant, query string, limit int) ([]SearchHit, error)
+	// Usage returns what the blogs of tenant take up.
+	Usage(ctx context.Context, tenant string) (TenantUsage, error)
+
+	// AddRevision records rev, replacing any revision of the same blog and
+	// version.
+	AddRevision(ctx context.Context, rev *Revision) error
+	// AddRevisions records revs in one go, like AddRevision.
+	AddRevisions(ctx context.Context, revs []Revision) error
+	// GetRevision returns the given version of a blog or ErrNotFound.
+	GetRevision(ctx context.Context, blogID primitive.ObjectID, version int64) (*Revision, error)
+	// ListRevisions returns up to limit revisions of a blog older than
+	// beforeVersion, newest first.
+	ListRevisions(ctx context.Context, blogID primitive.ObjectID, beforeVersion int64, limit int) ([]Revision, error)
+
+	// PublishDue publishes the scheduled blogs outside the trash whose
+	// PublishAt is not after now, or unset, and returns how many there were.
+	PublishDue(ctx context.Context, now time.Time) (int64, error)
+
+	// AddComment stores a new comment and returns it with its generated ID.
+	AddComment(ctx context.Context, c *CommentItem) (*CommentItem, error)
+	// GetComment returns the comment with the given id or ErrCommentNotFound.
+	GetComment(ctx context.Context, id primitive.ObjectID) (*CommentItem, error)
+	// ListComments returns up to limit comments of a blog created after the
+	// comment with the id after, when it is non-zero, oldest first. A non-nil
+	// parentID only keeps the direct replies to that comment, a zero one the
+	// top-level comments.
+	ListComments(ctx context.Context, blogID primitive.ObjectID, parentID *primitive.ObjectID, after primitive.ObjectID, limit int) ([]CommentItem, error)
+	// DeleteComment removes the comment with the given id and all its
+	// replies and returns how many comments that was. It fails with
+	// ErrCommentNotFound.
+	DeleteComment(ctx context.Context, id primitive.ObjectID) (int64, error)
+
+	// CreateAuthor stores a new author in the tenant of a or fails with
+	// ErrAuthorExists when the tenant already has one with its id.
+	CreateAuthor(ctx context.Context, a *AuthorItem) (*AuthorItem, error)
+	// GetAuthor returns the author of tenant with the given id or
+	// ErrAuthorNotFound.
+	GetAuthor(ctx context.Context, tenant, id string) (*AuthorItem, error)
+	// UpdateAuthor writes the fields set in u to the author of tenant with
+	// the given id and returns the result, or fails with ErrAuthorNotFound.
+	UpdateAuthor(ctx context.Context, tenant, id string, u AuthorUpdate) (*AuthorItem, error)
+	// ListAuthors returns up to limit authors of tenant whose id sorts after
+	// after, ordered by id.
+	ListAuthors(ctx context.Context, tenant, after string, limit int) ([]AuthorItem, error)
+
+	// Atomically calls fn with a store whose writes all take effect when fn
+	// returns nil and none of them otherwise.
+	Atomically(ctx context.Context, fn func(ctx context.Context, tx BlogStore) error) error
+
+	// Watch calls fn for every change matching opts from now on, or from
+	// the resume token on, until ctx is done or fn fails.
+	Watch(ctx context.Context, opts WatchOptions, fn func(*BlogEvent) error) error
+}
@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoTestURIEnv names the environment variable holding the MongoDB server
+// the store tests also run against, besides the in-process backends.
+const mongoTestURIEnv = "BLOG_TEST_MONGO_URI"
+
+// forEachStore runs test against an empty store of every backend.
+func forEachStore(t *testing.T, test func(t *testing.T, store BlogStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+	t.Run("file", func(t *testing.T) {
+		store, err := NewFileStore(filepath.Join(t.TempDir(), "blogs.bson"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, store)
+	})
+	t.Run("mongo", func(t *testing.T) {
+		test(t, newTestMongoStore(t))
+	})
+}
+
+// newTestMongoDB returns a fresh database dropped once the test is done,
+// skipping the test when no server is configured.
+func newTestMongoDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv(mongoTestURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", mongoTestURIEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Cannot connect to MongoDB: %v", err)
+	}
+	db := client.Database("blog_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return db
+}
+
+// newTestMongoStore returns a store over a fresh, indexed database.
+func newTestMongoStore(t *testing.T) BlogStore {
+	t.Helper()
+	db := newTestMongoDB(t)
+	if err := EnsureIndexes(context.Background(), db); err != nil {
+		t.Fatalf("Cannot create the indexes: %v", err)
+	}
+	return NewMongoStore(db)
+}
+
+func TestStoreCRUD(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "Title", Content: "Content"})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if created.ID.IsZero() {
+			t.Fatalf("Create returned no id")
+		}
+
+		got, err := store.Get(ctx, created.ID)
+		if err != nil || !reflect.DeepEqual(got, created) {
+			t.Errorf("Get = %+v, %v, want %+v", got, err, created)
+		}
+
+		replaced := *created
+		replaced.Title = "Replaced"
+		if err := store.Replace(ctx, &replaced); err != nil {
+			t.Fatalf("Replace: %v", err)
+		}
+		if got, err := store.Get(ctx, created.ID); err != nil || got.Title != "Replaced" {
+			t.Errorf("Get after Replace = %+v, %v, want the new title", got, err)
+		}
+
+		missing := primitive.NewObjectID()
+		if _, err := store.Get(ctx, missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of a missing blog: error = %v, want %v", err, ErrNotFound)
+		}
+		if err := store.Replace(ctx, &BlogItem{ID: missing}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Replace of a missing blog: error = %v, want %v", err, ErrNotFound)
+		}
+		if err := store.Delete(ctx, missing, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete of a missing blog: error = %v, want %v", err, ErrNotFound)
+		}
+
+		if err := store.Delete(ctx, created.ID, 0); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Get(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+// seedBlogs creates a blog by ann for each title, in order, and returns
+// their ids.
+func seedBlogs(t *testing.T, store BlogStore, titles ...string) []primitive.ObjectID {
+	t.Helper()
+	ids := make([]primitive.ObjectID, len(titles))
+	for i, title := range titles {
+		created, err := store.Create(context.Background(), &BlogItem{AuthorID: "ann", Title: title, CreatedAt: now()})
+		if err != nil {
+			t.Fatalf("Create(%q): %v", title, err)
+		}
+		ids[i] = created.ID
+	}
+	return ids
+}
+
+// listIDs returns the ids of the blogs store lists for opts.
+func listIDs(t *testing.T, store BlogStore, opts ListOptions) []primitive.ObjectID {
+	t.Helper()
+	var ids []primitive.ObjectID
+	err := store.List(context.Background(), opts, func(item *BlogItem) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return ids
+}
+
+func TestStoreListOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ids := seedBlogs(t, store, "b", "c", "a")
+		bobs, err := store.Create(context.Background(), &BlogItem{AuthorID: "bob", Title: "by bob", CreatedAt: now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := func(id primitive.ObjectID) *Cursor {
+			item, err := store.Get(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor := item.cursor()
+			return &cursor
+		}
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []primitive.ObjectID
+		}{
+			{"created", ListOptions{}, []primitive.ObjectID{ids[0], ids[1], ids[2], bobs.ID}},
+			{"created descending", ListOptions{Descending: true}, []primitive.ObjectID{bobs.ID, ids[2], ids[1], ids[0]}},
+			{"title", ListOptions{SortBy: SortByTitle}, []primitive.ObjectID{ids[2], ids[0], bobs.ID, ids[1]}},
+			{"limit", ListOptions{SortBy: SortByTitle, Limit: 2}, []primitive.ObjectID{ids[2], ids[0]}},
+			{"author", ListOptions{AuthorID: "ann"}, ids},
+			{"title prefix", ListOptions{TitlePrefix: "c"}, []primitive.ObjectID{ids[1]}},
+			{"title contains", ListOptions{TitleContains: "bo"}, []primitive.ObjectID{bobs.ID}},
+			{"after", ListOptions{After: after(ids[0])}, []primitive.ObjectID{ids[1], ids[2], bobs.ID}},
+			{"after descending", ListOptions{Descending: true, After: after(ids[1])}, []primitive.ObjectID{ids[0]}},
+			{"after title", ListOptions{SortBy: SortByTitle, After: &Cursor{ID: ids[0], Title: "b"}}, []primitive.ObjectID{bobs.ID, ids[1]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List = %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = store.List(context.Background(), ListOptions{}, func(item *BlogItem) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("List with a failing callback = %v after %d calls, want %v after 1", err, calls, stop)
+		}
+	})
+}
+
+// TestStoreListPages walks every ordering a page at a time through the
+// cursors of the page tokens, which must go through every blog once.
+func TestStoreListPages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		seedBlogs(t, store, "e", "a", "d", "a", "c", "b", "a")
+
+		for _, sortBy := range []SortField{SortByCreated, SortByTitle, SortByUpdated} {
+			for _, desc := range []bool{false, true} {
+				opts := ListOptions{SortBy: sortBy, Descending: desc}
+				want := listIDs(t, store, opts)
+
+				var got []primitive.ObjectID
+				page := opts
+				page.Limit = 3
+				for {
+					ids := listIDs(t, store, page)
+					got = append(got, ids...)
+					if len(ids) < page.Limit {
+						break
+					}
+					last, err := store.Get(context.Background(), ids[len(ids)-1])
+					if err != nil {
+						t.Fatal(err)
+					}
+					cursor := last.cursor()
+					page.After = &cursor
+				}
+				if len(want) != 7 || !reflect.DeepEqual(got, want) {
+					t.Errorf("sort %v descending %v: pages list %v, want %v", sortBy, desc, got, want)
+				}
+			}
+		}
+	})
+}
+
+func TestStoreListCreatedRange(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ids := seedBlogs(t, store, "a", "b")
+		now := time.Now()
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []primitive.ObjectID
+		}{
+			{"after an hour ago", ListOptions{CreatedAfter: now.Add(-time.Hour)}, ids},
+			{"after an hour from now", ListOptions{CreatedAfter: now.Add(time.Hour)}, nil},
+			{"before an hour ago", ListOptions{CreatedBefore: now.Add(-time.Hour)}, nil},
+			{"within the hour", ListOptions{CreatedAfter: now.Add(-time.Hour), CreatedBefore: now.Add(time.Hour)}, ids},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestStoreListCreatedAt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		// imported blogs keep when they were first created, so their
+		// ids are out of creation order
+		var ids []primitive.ObjectID
+		for _, created := range []time.Time{
+			time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		} {
+			item, err := store.Create(context.Background(), &BlogItem{AuthorID: "ann", Title: "t", CreatedAt: created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, item.ID)
+		}
+		year := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []primitive.ObjectID
+		}{
+			{"created order", ListOptions{}, []primitive.ObjectID{ids[1], ids[2], ids[0]}},
+			{"descending", ListOptions{Descending: true}, []primitive.ObjectID{ids[0], ids[2], ids[1]}},
+			{"after a cursor", ListOptions{After: &Cursor{ID: ids[1], CreatedAt: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)}}, []primitive.ObjectID{ids[2], ids[0]}},
+			{"created after", ListOptions{CreatedAfter: year}, []primitive.ObjectID{ids[2], ids[0]}},
+			{"created before", ListOptions{CreatedBefore: year}, []primitive.ObjectID{ids[1]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		var ids []primitive.ObjectID
+		for _, item := range []BlogItem{
+			{AuthorID: "ann", Title: "Cooking", Content: "a grpc recipe"},
+			{AuthorID: "ann", Title: "gRPC streaming", Content: "streams over grpc"},
+			{AuthorID: "ann", Title: "Gardening", Content: "nothing to see"},
+		} {
+			item := item
+			created, err := store.Create(ctx, &item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, created.ID)
+		}
+
+		hits, err := store.Search(ctx, "", "grpc", 10)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		var got []primitive.ObjectID
+		for _, hit := range hits {
+			got = append(got, hit.Item.ID)
+		}
+		if want := []primitive.ObjectID{ids[1], ids[0]}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Search = %v, want %v", got, want)
+		}
+
+		if hits, err := store.Search(ctx, "", "grpc", 1); err != nil || len(hits) != 1 {
+			t.Errorf("Search with limit 1 = %d hits, %v, want 1", len(hits), err)
+		}
+		if err := store.Delete(ctx, ids[1], 0); err != nil {
+			t.Fatal(err)
+		}
+		if hits, err := store.Search(ctx, "", "streaming", 10); err != nil || len(hits) != 0 {
+			t.Errorf("Search of a deleted blog = %d hits, %v, want none", len(hits), err)
+		}
+	})
+}
+
+func TestStoreUpdate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "Title", Content: "Content"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		title := "New title"
+		updated, err := store.Update(ctx, created.ID, BlogUpdate{Title: &title})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		want := *created
+		want.Title = title
+		want.Version++
+		if !reflect.DeepEqual(*updated, want) {
+			t.Errorf("Update = %+v, want %+v", updated, want)
+		}
+		if got, err := store.Get(ctx, created.ID); err != nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("Get after Update = %+v, %v, want %+v", got, err, want)
+		}
+
+		if _, err := store.Update(ctx, primitive.NewObjectID(), BlogUpdate{Title: &title}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update of a missing blog: error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestStoreVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "Title"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.Version != 1 {
+			t.Fatalf("Create: version = %d, want 1", created.Version)
+		}
+
+		title := "Second"
+		updated, err := store.Update(ctx, created.ID, BlogUpdate{Title: &title, IfVersion: 1})
+		if err != nil || updated.Version != 2 {
+			t.Fatalf("Update at version 1 = %+v, %v, want version 2", updated, err)
+		}
+		if _, err := store.Update(ctx, created.ID, BlogUpdate{Title: &title, IfVersion: 1}); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("Update at a stale version: error = %v, want %v", err, ErrVersionMismatch)
+		}
+		if _, err := store.Update(ctx, primitive.NewObjectID(), BlogUpdate{IfVersion: 1}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update of a missing blog at a version: error = %v, want %v", err, ErrNotFound)
+		}
+		if err := store.Delete(ctx, created.ID, 1); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("Delete at a stale version: error = %v, want %v", err, ErrVersionMismatch)
+		}
+		if err := store.Delete(ctx, created.ID, 2); err != nil {
+			t.Errorf("Delete at the current version: %v", err)
+		}
+	})
+}
+
+func TestStoreListReader(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		var ids []primitive.ObjectID
+		for _, item := range []BlogItem{
+			{AuthorID: "ann", Title: "legacy"},
+			{AuthorID: "ann", Title: "published", Status: StatusPublished},
+			{AuthorID: "ann", Title: "draft", Status: StatusDraft},
+			{AuthorID: "bob", Title: "archived", Status: StatusArchived},
+		} {
+			item := item
+			created, err := store.Create(ctx, &item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, created.ID)
+		}
+
+		all := []BlogStatus{StatusPublished, StatusDraft, StatusArchived}
+		ann, bob, nobody := "ann", "bob", ""
+		for _, tt := range []struct {
+			reader *string
+			want   []primitive.ObjectID
+		}{
+			{nil, ids},
+			{&ann, ids[:3]},
+			{&bob, []primitive.ObjectID{ids[0], ids[1], ids[3]}},
+			{&nobody, ids[:2]},
+		} {
+			if got := listIDs(t, store, ListOptions{Statuses: all, ReaderID: tt.reader}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List for reader %v = %v, want %v", tt.reader, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestStoreListUpdated(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		ids := seedBlogs(t, store, "a", "b", "c")
+		base := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		for i, id := range []primitive.ObjectID{ids[1], ids[2], ids[0]} {
+			if _, err := store.Update(ctx, id, BlogUpdate{UpdatedAt: base.Add(time.Duration(i) * time.Minute)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := []primitive.ObjectID{ids[1], ids[2], ids[0]}
+		if got := listIDs(t, store, ListOptions{SortBy: SortByUpdated}); !reflect.DeepEqual(got, want) {
+			t.Errorf("List by update = %v, want %v", got, want)
+		}
+		after := &Cursor{ID: ids[1], UpdatedAt: base}
+		want = []primitive.ObjectID{ids[2], ids[0]}
+		if got := listIDs(t, store, ListOptions{SortBy: SortByUpdated, After: after}); !reflect.DeepEqual(got, want) {
+			t.Errorf("List by update after the first = %v, want %v", got, want)
+		}
+		if got, err := store.Get(ctx, ids[0]); err != nil || !got.UpdatedAt.Equal(base.Add(2*time.Minute)) {
+			t.Errorf("Get after Update = %+v, %v, want updated at %v", got, err, base.Add(2*time.Minute))
+		}
+	})
+}
+
+func TestStoreTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		ids := seedBlogs(t, store, "kept", "trashed")
+		yes, no := true, false
+		title := "edited"
+
+		trashedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		trashed, err := store.Update(ctx, ids[1], BlogUpdate{Deleted: &yes, UpdatedAt: trashedAt})
+		if err != nil {
+			t.Fatalf("moving to the trash: %v", err)
+		}
+		if trashed.DeletedAt == nil || !trashed.DeletedAt.Equal(trashedAt) {
+			t.Errorf("DeletedAt = %v, want %v", trashed.DeletedAt, trashedAt)
+		}
+
+		if _, err := store.Update(ctx, ids[1], BlogUpdate{Title: &title}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("editing a blog in the trash: error = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := store.Update(ctx, ids[1], BlogUpdate{Deleted: &yes}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("trashing a blog twice: error = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := store.Update(ctx, ids[0], BlogUpdate{Deleted: &no}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("restoring a live blog: error = %v, want %v", err, ErrNotFound)
+		}
+
+		listings := []struct {
+			deleted DeletedFilter
+			want    []primitive.ObjectID
+		}{
+			{ExcludeDeleted, ids[:1]},
+			{OnlyDeleted, ids[1:]},
+			{IncludeDeleted, ids},
+		}
+		for _, l := range listings {
+			if got := listIDs(t, store, ListOptions{Deleted: l.deleted}); !reflect.DeepEqual(got, l.want) {
+				t.Errorf("List deleted %v = %v, want %v", l.deleted, got, l.want)
+			}
+		}
+		if hits, err := store.Search(ctx, "", "trashed", 10); err != nil || len(hits) != 0 {
+			t.Errorf("Search of a blog in the trash = %d hits, %v, want none", len(hits), err)
+		}
+
+		if purged, err := store.Purge(ctx, trashedAt); err != nil || len(purged) != 0 {
+			t.Errorf("Purge before the blog was trashed = %d blogs, %v, want none", len(purged), err)
+		}
+		restored, err := store.Update(ctx, ids[1], BlogUpdate{Deleted: &no})
+		if err != nil || restored.DeletedAt != nil {
+			t.Fatalf("restoring = %v, %v, want a live blog", restored, err)
+		}
+		if _, err := store.Update(ctx, ids[1], BlogUpdate{Deleted: &yes, UpdatedAt: trashedAt}); err != nil {
+			t.Fatal(err)
+		}
+
+		purged, err := store.Purge(ctx, trashedAt.Add(time.Second))
+		if err != nil || len(purged) != 1 || purged[0].ID != ids[1] {
+			t.Fatalf("Purge = %v, %v, want the blog in the trash", purged, err)
+		}
+		if _, err := store.Get(ctx, ids[1]); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of a purged blog: error = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := store.Get(ctx, ids[0]); err != nil {
+			t.Errorf("Get of a live blog after a purge: %v", err)
+		}
+	})
+}
+
+func TestStoreRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		blog := seedBlogs(t, store, "v1")[0]
+		for v := int64(1); v <= 3; v++ {
+			rev := &Revision{BlogID: blog, Version: v, Blog: BlogItem{ID: blog, AuthorID: "ann", Title: "old", Version: v}}
+			if err := store.AddRevision(ctx, rev); err != nil {
+				t.Fatalf("AddRevision(%d): %v", v, err)
+			}
+		}
+		replaced := &Revision{BlogID: blog, Version: 2, Blog: BlogItem{ID: blog, AuthorID: "ann", Title: "v2", Version: 2}}
+		if err := store.AddRevision(ctx, replaced); err != nil {
+			t.Fatalf("AddRevision of an existing version: %v", err)
+		}
+
+		got, err := store.GetRevision(ctx, blog, 2)
+		if err != nil || got.Blog.Title != "v2" {
+			t.Errorf("GetRevision(2) = %+v, %v, want the replaced revision", got, err)
+		}
+		if _, err := store.GetRevision(ctx, blog, 9); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetRevision of a missing version: error = %v, want %v", err, ErrNotFound)
+		}
+
+		revs, err := store.ListRevisions(ctx, blog, 3, 10)
+		if err != nil {
+			t.Fatalf("ListRevisions: %v", err)
+		}
+		var versions []int64
+		for _, rev := range revs {
+			versions = append(versions, rev.Version)
+		}
+		if want := []int64{2, 1}; !reflect.DeepEqual(versions, want) {
+			t.Errorf("ListRevisions before 3 = versions %v, want %v", versions, want)
+		}
+		if revs, err := store.ListRevisions(ctx, blog, 4, 1); err != nil || len(revs) != 1 || revs[0].Version != 3 {
+			t.Errorf("ListRevisions with limit 1 = %+v, %v, want version 3", revs, err)
+		}
+
+		yes := true
+		deletedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		if _, err := store.Update(ctx, blog, BlogUpdate{Deleted: &yes, UpdatedAt: deletedAt}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Purge(ctx, deletedAt.Add(time.Second)); err != nil {
+			t.Fatalf("Purge: %v", err)
+		}
+		if _, err := store.GetRevision(ctx, blog, 1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetRevision of a purged blog: error = %v, want %v", err, ErrNotFound)
+		}
+
+		deleted := seedBlogs(t, store, "deleted")[0]
+		rev := &Revision{BlogID: deleted, Version: 1, Blog: BlogItem{ID: deleted, AuthorID: "ann", Title: "old", Version: 1}}
+		if err := store.AddRevision(ctx, rev); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(ctx, deleted, 0); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.GetRevision(ctx, deleted, 1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetRevision of a deleted blog: error = %v, want %v", err, ErrNotFound)
+		}
+		if revs, err := store.ListRevisions(ctx, deleted, 2, 10); err != nil || len(revs) != 0 {
+			t.Errorf("ListRevisions of a deleted blog = %+v, %v, want none", revs, err)
+		}
+	})
+}
+
+func TestStoreAtomically(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		id := seedBlogs(t, store, "Original")[0]
+		title := "Changed"
+
+		errRollback := errors.New("rollback")
+		err := store.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+			if _, err := tx.Update(ctx, id, BlogUpdate{Title: &title}); err != nil {
+				return err
+			}
+			if _, errs := tx.CreateMany(ctx, []BlogItem{{AuthorID: "ann", Title: "New"}}); errs[0] != nil {
+				return errs[0]
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("Atomically = %v, want %v", err, errRollback)
+		}
+		if got := listIDs(t, store, ListOptions{}); !reflect.DeepEqual(got, []primitive.ObjectID{id}) {
+			t.Errorf("List after a rollback = %v, want only the original blog", got)
+		}
+		if got, err := store.Get(ctx, id); err != nil || got.Title != "Original" {
+			t.Errorf("Get after a rollback = %+v, %v, want the original title", got, err)
+		}
+
+		err = store.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+			_, err := tx.Update(ctx, id, BlogUpdate{Title: &title})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Atomically: %v", err)
+		}
+		if got, err := store.Get(ctx, id); err != nil || got.Title != title || got.Version != 2 {
+			t.Errorf("Get after a commit = %+v, %v, want the new title at version 2", got, err)
+		}
+	})
+}
+
+func TestStoreUpdateMany(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		ids := seedBlogs(t, store, "one", "two", "trashed")
+		yes := true
+		if _, err := store.Update(ctx, ids[2], BlogUpdate{Deleted: &yes, UpdatedAt: now()}); err != nil {
+			t.Fatal(err)
+		}
+
+		title := func(s string) *string { return &s }
+		updated, errs := store.UpdateMany(ctx,
+			[]primitive.ObjectID{ids[0], ids[1], ids[2], primitive.NewObjectID()},
+			[]BlogUpdate{
+				{Title: title("first"), IfVersion: 1},
+				{Title: title("stale"), IfVersion: 5},
+				{Title: title("in the trash"), IfVersion: 2},
+				{Title: title("missing"), IfVersion: 1},
+			})
+		wantErrs := []error{nil, ErrVersionMismatch, ErrNotFound, ErrNotFound}
+		for i, want := range wantErrs {
+			if !errors.Is(errs[i], want) {
+				t.Errorf("UpdateMany item %d: error = %v, want %v", i, errs[i], want)
+			}
+		}
+		if updated[0].Title != "first" || updated[0].Version != 2 {
+			t.Errorf("UpdateMany item 0 = %q at version %d, want first at version 2", updated[0].Title, updated[0].Version)
+		}
+		if got, err := store.Get(ctx, ids[1]); err != nil || got.Title != "two" || got.Version != 1 {
+			t.Errorf("blog of a stale update = %+v, %v, want it unchanged", got, err)
+		}
+	})
+}
+
+func TestStoreCreateMany(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, errs := store.CreateMany(ctx, []BlogItem{{AuthorID: "ann", Title: "a"}, {AuthorID: "ann", Title: "b"}})
+		for i := range created {
+			if errs[i] != nil {
+				t.Fatalf("CreateMany item %d: %v", i, errs[i])
+			}
+			got, err := store.Get(ctx, created[i].ID)
+			if err != nil || got.Title != created[i].Title || got.Version != 1 {
+				t.Errorf("Get of created blog %d = %+v, %v, want %+v", i, got, err, created[i])
+			}
+		}
+	})
+}
+
+func TestStoreCreateManyKeepsIDs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		taken := seedBlogs(t, store, "taken")[0]
+		preset := primitive.NewObjectID()
+
+		created, errs := store.CreateMany(ctx, []BlogItem{
+			{ID: preset, AuthorID: "ann", Title: "preset"},
+			{AuthorID: "ann", Title: "new"},
+			{ID: taken, AuthorID: "ann", Title: "clash"},
+		})
+		if errs[0] != nil || created[0].ID != preset {
+			t.Errorf("blog with a preset id = %v, %v, want it created under %v", created[0].ID, errs[0], preset)
+		}
+		if errs[1] != nil || created[1].ID.IsZero() {
+			t.Errorf("blog without an id = %v, %v, want it created under a new id", created[1].ID, errs[1])
+		}
+		if !errors.Is(errs[2], ErrAlreadyExists) {
+			t.Errorf("blog with a taken id: error = %v, want %v", errs[2], ErrAlreadyExists)
+		}
+		if stored, err := store.Get(ctx, taken); err != nil || stored.Title != "taken" {
+			t.Errorf("blog whose id was reused = %v, %v, want it unchanged", stored, err)
+		}
+	})
+}
+
+func TestStoreCreateWithID(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		preset := primitive.NewObjectID()
+		created, err := store.Create(ctx, &BlogItem{ID: preset, AuthorID: "ann", Title: "preset"})
+		if err != nil || created.ID != preset {
+			t.Fatalf("Create with an id = %+v, %v, want id %v", created, err, preset)
+		}
+		if _, err := store.Get(ctx, preset); err != nil {
+			t.Errorf("Get of a blog created with an id: %v", err)
+		}
+
+		yes := true
+		if _, err := store.Update(ctx, preset, BlogUpdate{Deleted: &yes, UpdatedAt: now()}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Create(ctx, &BlogItem{ID: preset, AuthorID: "ann", Title: "clash"}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("Create with the id of a blog in the trash: error = %v, want %v", err, ErrAlreadyExists)
+		}
+	})
+}
+
+// commentIDs returns the ids of comments.
+func commentIDs(comments []CommentItem) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestStoreComments(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		blogs := seedBlogs(t, store, "commented", "other")
+		add := func(blog primitive.ObjectID, parents ...primitive.ObjectID) primitive.ObjectID {
+			t.Helper()
+			c := &CommentItem{BlogID: blog, AuthorID: "bob", Content: "hi", CreatedAt: now()}
+			if len(parents) > 0 {
+				c.ParentID = parents[len(parents)-1]
+				c.Ancestors = parents
+			}
+			added, err := store.AddComment(ctx, c)
+			if err != nil {
+				t.Fatalf("AddComment: %v", err)
+			}
+			return added.ID
+		}
+		top := add(blogs[0])
+		reply := add(blogs[0], top)
+		nested := add(blogs[0], top, reply)
+		second := add(blogs[0])
+		other := add(blogs[1])
+		topLevel := primitive.NilObjectID
+
+		tests := []struct {
+			name   string
+			parent *primitive.ObjectID
+			after  primitive.ObjectID
+			limit  int
+			want   []primitive.ObjectID
+		}{
+			{"all", nil, primitive.NilObjectID, 10, []primitive.ObjectID{top, reply, nested, second}},
+			{"top level", &topLevel, primitive.NilObjectID, 10, []primitive.ObjectID{top, second}},
+			{"replies", &top, primitive.NilObjectID, 10, []primitive.ObjectID{reply}},
+			{"after", &topLevel, top, 10, []primitive.ObjectID{second}},
+			{"limit", nil, primitive.NilObjectID, 1, []primitive.ObjectID{top}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := store.ListComments(ctx, blogs[0], tt.parent, tt.after, tt.limit)
+				if err != nil {
+					t.Fatalf("ListComments: %v", err)
+				}
+				if ids := commentIDs(got); !reflect.DeepEqual(ids, tt.want) {
+					t.Errorf("ListComments = %v, want %v", ids, tt.want)
+				}
+			})
+		}
+
+		if n, err := store.DeleteComment(ctx, top); err != nil || n != 3 {
+			t.Errorf("DeleteComment of a thread = %d, %v, want 3", n, err)
+		}
+		for _, id := range []primitive.ObjectID{top, reply, nested} {
+			if _, err := store.GetComment(ctx, id); !errors.Is(err, ErrCommentNotFound) {
+				t.Errorf("GetComment of a deleted comment: error = %v, want %v", err, ErrCommentNotFound)
+			}
+		}
+		if _, err := store.DeleteComment(ctx, top); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("DeleteComment twice: error = %v, want %v", err, ErrCommentNotFound)
+		}
+
+		if err := store.Delete(ctx, blogs[0], 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetComment(ctx, second); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("GetComment of a deleted blog: error = %v, want %v", err, ErrCommentNotFound)
+		}
+		if _, err := store.GetComment(ctx, other); err != nil {
+			t.Errorf("GetComment of another blog: %v", err)
+		}
+	})
+}
+
+func TestStoreTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		var ids []primitive.ObjectID
+		for _, item := range []BlogItem{
+			{AuthorID: "ann", Title: "a", Tags: []string{"go", "grpc"}, Category: "tech"},
+			{AuthorID: "ann", Title: "b", Tags: []string{"go"}, Category: "tech"},
+			{AuthorID: "ann", Title: "c", Tags: []string{"grpc", "food"}, Category: "life"},
+			{AuthorID: "ann", Title: "d"},
+		} {
+			item := item
+			created, err := store.Create(ctx, &item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, created.ID)
+		}
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []primitive.ObjectID
+		}{
+			{"any tag", ListOptions{Tags: []string{"go", "food"}}, []primitive.ObjectID{ids[0], ids[1], ids[2]}},
+			{"all tags", ListOptions{Tags: []string{"go", "grpc"}, AllTags: true}, []primitive.ObjectID{ids[0]}},
+			{"category", ListOptions{Category: "tech"}, []primitive.ObjectID{ids[0], ids[1]}},
+			{"tag and category", ListOptions{Tags: []string{"grpc"}, Category: "life"}, []primitive.ObjectID{ids[2]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List = %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		yes := true
+		if _, err := store.Update(ctx, ids[1], BlogUpdate{Deleted: &yes, UpdatedAt: now()}); err != nil {
+			t.Fatal(err)
+		}
+		counts, err := store.CountTags(ctx, "", "")
+		if err != nil {
+			t.Fatalf("CountTags: %v", err)
+		}
+		want := []TagCount{{"grpc", 2}, {"food", 1}, {"go", 1}}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("CountTags = %v, want %v", counts, want)
+		}
+		counts, err = store.CountTags(ctx, "", "tech")
+		if err != nil {
+			t.Fatalf("CountTags: %v", err)
+		}
+		if want := []TagCount{{"go", 1}, {"grpc", 1}}; !reflect.DeepEqual(counts, want) {
+			t.Errorf("CountTags of a category = %v, want %v", counts, want)
+		}
+	})
+}
+
+func TestStorePublishDue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		past, future := now.Add(-time.Hour), now.Add(time.Hour)
+		var ids []primitive.ObjectID
+		for _, item := range []BlogItem{
+			{AuthorID: "ann", Title: "legacy"},
+			{AuthorID: "ann", Title: "draft", Status: StatusDraft},
+			{AuthorID: "ann", Title: "due", Status: StatusScheduled, PublishAt: &past},
+			{AuthorID: "ann", Title: "later", Status: StatusScheduled, PublishAt: &future},
+			{AuthorID: "ann", Title: "trashed", Status: StatusScheduled, PublishAt: &past},
+		} {
+			item := item
+			created, err := store.Create(ctx, &item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, created.ID)
+		}
+		yes := true
+		if _, err := store.Update(ctx, ids[4], BlogUpdate{Deleted: &yes, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+
+		published := ListOptions{Statuses: []BlogStatus{StatusPublished}}
+		if got, want := listIDs(t, store, published), ids[:1]; !reflect.DeepEqual(got, want) {
+			t.Errorf("List of published blogs = %v, want %v", got, want)
+		}
+		if hits, err := store.Search(ctx, "", "draft", 10); err != nil || len(hits) != 0 {
+			t.Errorf("Search of a draft = %d hits, %v, want none", len(hits), err)
+		}
+
+		if n, err := store.PublishDue(ctx, now); err != nil || n != 1 {
+			t.Fatalf("PublishDue = %d, %v, want 1", n, err)
+		}
+		if got, want := listIDs(t, store, published), []primitive.ObjectID{ids[0], ids[2]}; !reflect.DeepEqual(got, want) {
+			t.Errorf("List of published blogs after PublishDue = %v, want %v", got, want)
+		}
+		scheduled := ListOptions{Statuses: []BlogStatus{StatusScheduled}, Deleted: IncludeDeleted}
+		if got, want := listIDs(t, store, scheduled), ids[3:]; !reflect.DeepEqual(got, want) {
+			t.Errorf("List of scheduled blogs after PublishDue = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestStorePublishDueWithoutTime(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "undated", Status: StatusScheduled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := store.PublishDue(ctx, now()); err != nil || n != 1 {
+			t.Fatalf("PublishDue = %d, %v, want 1", n, err)
+		}
+		if got, err := store.Get(ctx, created.ID); err != nil || got.status() != StatusPublished {
+			t.Errorf("scheduled blog without a time after PublishDue = %+v, %v, want it published", got, err)
+		}
+	})
+}
+
+func TestStoreSlugs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "a", Slug: "a", Slugs: []string{"a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "b", Slug: "b", Slugs: []string{"b"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Create(ctx, &BlogItem{AuthorID: "ann", Title: "a", Slug: "a", Slugs: []string{"a"}}); !errors.Is(err, ErrSlugTaken) {
+			t.Errorf("Create with a taken slug: error = %v, want %v", err, ErrSlugTaken)
+		}
+
+		renamed := "renamed"
+		updated, err := store.Update(ctx, created.ID, BlogUpdate{Slug: &renamed})
+		if err != nil {
+			t.Fatalf("Update of the slug: %v", err)
+		}
+		if want := []string{"a", "renamed"}; updated.Slug != renamed || !reflect.DeepEqual(updated.Slugs, want) {
+			t.Errorf("Update of the slug = %q %q, want %q %q", updated.Slug, updated.Slugs, renamed, want)
+		}
+		for _, slug := range []string{"a", "renamed"} {
+			if got, err := store.GetBySlug(ctx, "", slug); err != nil || got.ID != created.ID {
+				t.Errorf("GetBySlug(%q) = %+v, %v, want blog %v", slug, got, err, created.ID)
+			}
+		}
+		if _, err := store.GetBySlug(ctx, "", "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetBySlug of a missing slug: error = %v, want %v", err, ErrNotFound)
+		}
+
+		taken := "a"
+		if _, err := store.Update(ctx, other.ID, BlogUpdate{Slug: &taken}); !errors.Is(err, ErrSlugTaken) {
+			t.Errorf("Update to an old slug of another blog: error = %v, want %v", err, ErrSlugTaken)
+		}
+	})
+}
+
+func TestStoreAuthors(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		for _, id := range []string{"cat", "ann", "bob"} {
+			if _, err := store.CreateAuthor(ctx, &AuthorItem{ID: id, DisplayName: id, CreatedAt: now()}); err != nil {
+				t.Fatalf("CreateAuthor(%q): %v", id, err)
+			}
+		}
+		if _, err := store.CreateAuthor(ctx, &AuthorItem{ID: "ann"}); !errors.Is(err, ErrAuthorExists) {
+			t.Errorf("CreateAuthor of a taken id: error = %v, want %v", err, ErrAuthorExists)
+		}
+
+		bio := "Writes about Go"
+		updated, err := store.UpdateAuthor(ctx, "", "ann", AuthorUpdate{Bio: &bio, UpdatedAt: now()})
+		if err != nil || updated.Bio != bio || updated.DisplayName != "ann" {
+			t.Errorf("UpdateAuthor = %+v, %v, want the new bio and the old name", updated, err)
+		}
+		if got, err := store.GetAuthor(ctx, "", "ann"); err != nil || got.Bio != bio {
+			t.Errorf("GetAuthor after UpdateAuthor = %+v, %v, want the new bio", got, err)
+		}
+		if _, err := store.UpdateAuthor(ctx, "", "dan", AuthorUpdate{Bio: &bio}); !errors.Is(err, ErrAuthorNotFound) {
+			t.Errorf("UpdateAuthor of a missing author: error = %v, want %v", err, ErrAuthorNotFound)
+		}
+		if _, err := store.GetAuthor(ctx, "", "dan"); !errors.Is(err, ErrAuthorNotFound) {
+			t.Errorf("GetAuthor of a missing author: error = %v, want %v", err, ErrAuthorNotFound)
+		}
+
+		// ids are unique per tenant
+		if _, err := store.CreateAuthor(ctx, &AuthorItem{ID: "ann", Tenant: "other", Email: "ann@other.example"}); err != nil {
+			t.Fatalf("CreateAuthor of a taken id in another tenant: %v", err)
+		}
+		if got, err := store.GetAuthor(ctx, "", "ann"); err != nil || got.Email != "" {
+			t.Errorf("GetAuthor = %+v, %v, want the author of the default tenant", got, err)
+		}
+		if got, err := store.GetAuthor(ctx, "other", "ann"); err != nil || got.Email != "ann@other.example" {
+			t.Errorf("GetAuthor of another tenant = %+v, %v, want its own author", got, err)
+		}
+		if _, err := store.GetAuthor(ctx, "other", "bob"); !errors.Is(err, ErrAuthorNotFound) {
+			t.Errorf("GetAuthor of an author of another tenant: error = %v, want %v", err, ErrAuthorNotFound)
+		}
+		if _, err := store.UpdateAuthor(ctx, "other", "bob", AuthorUpdate{Bio: &bio}); !errors.Is(err, ErrAuthorNotFound) {
+			t.Errorf("UpdateAuthor of an author of another tenant: error = %v, want %v", err, ErrAuthorNotFound)
+		}
+
+		for _, tc := range []struct {
+			tenant, after string
+			want          []string
+		}{
+			{"", "ann", []string{"bob", "cat"}},
+			{"other", "", []string{"ann"}},
+		} {
+			authors, err := store.ListAuthors(ctx, tc.tenant, tc.after, 10)
+			if err != nil {
+				t.Fatalf("ListAuthors: %v", err)
+			}
+			var ids []string
+			for _, a := range authors {
+				ids = append(ids, a.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.want) {
+				t.Errorf("ListAuthors of tenant %q after %q = %v, want %v", tc.tenant, tc.after, ids, tc.want)
+			}
+		}
+	})
+}
+
+func TestStoreUsage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store BlogStore) {
+		ctx := context.Background()
+		for _, item := range []*BlogItem{
+			{AuthorID: "ann", Title: "One", Content: "12345", Tenant: "a"},
+			{AuthorID: "ann", Title: "Two", Content: "1", Tenant: "a"},
+			{AuthorID: "ann", Title: "Three", Content: "123", Tenant: "b"},
+		} {
+			if _, err := store.Create(ctx, item); err != nil {
+				t.Fatalf("Create(%q): %v", item.Title, err)
+			}
+		}
+
+		for _, tt := range []struct {
+			tenant string
+			want   TenantUsage
+		}{
+			{"a", TenantUsage{Blogs: 2, Bytes: 12}},
+			{"b", TenantUsage{Blogs: 1, Bytes: 8}},
+			{"c", TenantUsage{}},
+		} {
+			if got, err := store.Usage(ctx, tt.tenant); err != nil || got != tt.want {
+				t.Errorf("Usage(%q) = %+v, %v, want %+v", tt.tenant, got, err, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+)
+
+// TagCount is the number of blogs carrying a tag.
+type TagCount struct {
+	Tag   string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// normalizeTags trims and lower-cases tags and drops empty and repeated
+// ones, keeping the first occurrence of each.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// sortTagCounts orders counts the way CountTags returns them.
+func sortTagCounts(counts []TagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+}
+
+// hasTags reports whether item carries any of tags, or all of them when all
+// is set.
+func (item *BlogItem) hasTags(tags []string, all bool) bool {
+	for _, want := range tags {
+		found := false
+		for _, t := range item.Tags {
+			if t == want {
+				found = true
+				break
+			}
+		}
+		if found && !all {
+			return true
+		}
+		if !found && all {
+			return false
+		}
+	}
+	return all
+}
+
+func (s *server) ListTags(ctx context.Context, req *blogpb.ListTagsRequest) (*blogpb.ListTagsResponse, error) {
+	fmt.Println("ListTags invoked")
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	counts, err := s.store.CountTags(ctx, TenantFromContext(ctx), strings.TrimSpace(req.GetCategory()))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &blogpb.ListTagsResponse{}
+	for _, c := range counts {
+		res.Tags = append(res.Tags, &blogpb.TagCount{
+			Tag:   c.Tag,
+			Count: c.Count,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := normalizeTags([]string{" Go ", "gRPC", "", "go", "  "})
+	if want := []string{"go", "grpc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeTags = %q, want %q", got, want)
+	}
+	if got := normalizeTags(nil); got != nil {
+		t.Errorf("normalizeTags(nil) = %q, want nil", got)
+	}
+}
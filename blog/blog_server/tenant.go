@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"regexp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tenantHeader is the metadata naming the tenant of a request.
+const tenantHeader = "x-tenant-id"
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a copy of ctx scoped to tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant a request is scoped to, empty for
+// the default one.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// requestTenant finds the tenant of a request. Authenticated callers are
+// bound to the tenant of their identity, while trustHeader lets the tenant
+// header pick it, for servers that do not authenticate their callers.
+func requestTenant(ctx context.Context, trustHeader bool) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var requested string
+	if values := md.Get(tenantHeader); len(values) > 0 {
+		requested = values[0]
+	}
+
+	tenant := requested
+	if !trustHeader {
+		tenant = ""
+		if caller := IdentityFromContext(ctx); caller != nil {
+			tenant = caller.Tenant
+		}
+		if requested != "" && requested != tenant {
+			return "", status.Errorf(codes.PermissionDenied, "Caller does not belong to the tenant %q\n", requested)
+		}
+	}
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return "", status.Errorf(codes.InvalidArgument, "Invalid tenant %q: must be up to 63 lowercase letters, digits and '-'\n", tenant)
+	}
+	return tenant, nil
+}
+
+// TenantUnaryInterceptor scopes every unary call to the tenant of its
+// caller, see requestTenant. It must run after the authentication
+// interceptors.
+func TenantUnaryInterceptor(trustHeader bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		tenant, err := requestTenant(ctx, trustHeader)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ContextWithTenant(ctx, tenant), req)
+	}
+}
+
+// TenantStreamInterceptor is the streaming counterpart of
+// TenantUnaryInterceptor.
+func TenantStreamInterceptor(trustHeader bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		tenant, err := requestTenant(ss.Context(), trustHeader)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ContextWithTenant(ss.Context(), tenant)})
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// tenantStore scopes a BlogStore to the tenant of the context of each call:
+// blogs and authors are created in it, and those of other tenants, with the
+// revisions and comments of their blogs, are not found. The maintenance
+// methods Purge and PublishDue still work on every tenant.
+type tenantStore struct {
+	BlogStore
+}
+
+// NewTenantStore returns a BlogStore scoping store to the tenant of the
+// context of each call, see TenantFromContext.
+func NewTenantStore(store BlogStore) BlogStore {
+	return &tenantStore{BlogStore: store}
+}
+
+// owns hides a blog of another tenant than the one of ctx.
+func owns(ctx context.Context, item *BlogItem) (*BlogItem, error) {
+	if item.Tenant != TenantFromContext(ctx) {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+// hideForeign turns the failure to create a blog under an id taken in
+// another tenant into ErrNotFound, like every other access to that blog.
+func (s *tenantStore) hideForeign(ctx context.Context, id primitive.ObjectID, err error) error {
+	if !errors.Is(err, ErrAlreadyExists) || id.IsZero() {
+		return err
+	}
+	if _, getErr := s.Get(ctx, id); errors.Is(getErr, ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *tenantStore) Create(ctx context.Context, item *BlogItem) (*BlogItem, error) {
+	scoped := *item
+	scoped.Tenant = TenantFromContext(ctx)
+	created, err := s.BlogStore.Create(ctx, &scoped)
+	if err != nil {
+		return nil, s.hideForeign(ctx, item.ID, err)
+	}
+	return created, nil
+}
+
+func (s *tenantStore) CreateMany(ctx context.Context, items []BlogItem) ([]BlogItem, []error) {
+	scoped := make([]BlogItem, len(items))
+	for i := range items {
+		scoped[i] = items[i]
+		scoped[i].Tenant = TenantFromContext(ctx)
+	}
+	created, errs := s.BlogStore.CreateMany(ctx, scoped)
+	for i, err := range errs {
+		if err != nil {
+			errs[i] = s.hideForeign(ctx, items[i].ID, err)
+		}
+	}
+	return created, errs
+}
+
+func (s *tenantStore) Get(ctx context.Context, id primitive.ObjectID) (*BlogItem, error) {
+	item, err := s.BlogStore.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return owns(ctx, item)
+}
+
+func (s *tenantStore) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]*BlogItem, error) {
+	items, err := s.BlogStore.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if item != nil && item.Tenant != TenantFromContext(ctx) {
+			items[i] = nil
+		}
+	}
+	return items, nil
+}
+
+// GetBySlug ignores the given tenant for the one of ctx.
+func (s *tenantStore) GetBySlug(ctx context.Context, tenant, slug string) (*BlogItem, error) {
+	return s.BlogStore.GetBySlug(ctx, TenantFromContext(ctx), slug)
+}
+
+func (s *tenantStore) Replace(ctx context.Context, item *BlogItem) error {
+	if _, err := s.Get(ctx, item.ID); err != nil {
+		return err
+	}
+	scoped := *item
+	scoped.Tenant = TenantFromContext(ctx)
+	return s.BlogStore.Replace(ctx, &scoped)
+}
+
+func (s *tenantStore) Update(ctx context.Context, id primitive.ObjectID, u BlogUpdate) (*BlogItem, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.BlogStore.Update(ctx, id, u)
+}
+
+// UpdateMany fails the updates of blogs of other tenants with ErrNotFound.
+func (s *tenantStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, updates []BlogUpdate) ([]BlogItem, []error) {
+	updated := make([]BlogItem, len(ids))
+	errs := make([]error, len(ids))
+	items, err := s.GetMany(ctx, ids)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return updated, errs
+	}
+
+	// owned holds the index of each blog of the tenant
+	var owned []int
+	var ownedIDs []primitive.ObjectID
+	var ownedUpdates []BlogUpdate
+	for i, item := range items {
+		if item == nil {
+			errs[i] = ErrNotFound
+			continue
+		}
+		owned = append(owned, i)
+		ownedIDs = append(ownedIDs, ids[i])
+		ownedUpdates = append(ownedUpdates, updates[i])
+	}
+	done, doneErrs := s.BlogStore.UpdateMany(ctx, ownedIDs, ownedUpdates)
+	for j, i := range owned {
+		updated[i], errs[i] = done[j], doneErrs[j]
+	}
+	return updated, errs
+}
+
+func (s *tenantStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int64) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.BlogStore.Delete(ctx, id, ifVersion)
+}
+
+func (s *tenantStore) List(ctx context.Context, opts ListOptions, fn func(*BlogItem) error) error {
+	tenant := TenantFromContext(ctx)
+	opts.Tenant = &tenant
+	return s.BlogStore.List(ctx, opts, fn)
+}
+
+// CountTags ignores the given tenant for the one of ctx.
+func (s *tenantStore) CountTags(ctx context.Context, tenant, category string) ([]TagCount, error) {
+	return s.BlogStore.CountTags(ctx, TenantFromContext(ctx), category)
+}
+
+// Search ignores the given tenant for the one of ctx.
+func (s *tenantStore) Search(ctx context.Context, tenant, query string, limit int) ([]SearchHit, error) {
+	return s.BlogStore.Search(ctx, TenantFromContext(ctx), query, limit)
+}
+
+// Usage ignores the given tenant for the one of ctx.
+func (s *tenantStore) Usage(ctx context.Context, tenant string) (TenantUsage, error) {
+	return s.BlogStore.Usage(ctx, TenantFromContext(ctx))
+}
+
+func (s *tenantStore) AddRevision(ctx context.Context, rev *Revision) error {
+	if _, err := s.Get(ctx, rev.BlogID); err != nil {
+		return err
+	}
+	return s.BlogStore.AddRevision(ctx, rev)
+}
+
+func (s *tenantStore) AddRevisions(ctx context.Context, revs []Revision) error {
+	ids := make([]primitive.ObjectID, len(revs))
+	for i := range revs {
+		ids[i] = revs[i].BlogID
+	}
+	items, err := s.GetMany(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item == nil {
+			return ErrNotFound
+		}
+	}
+	return s.BlogStore.AddRevisions(ctx, revs)
+}
+
+func (s *tenantStore) GetRevision(ctx context.Context, blogID primitive.ObjectID, version int64) (*Revision, error) {
+	if _, err := s.Get(ctx, blogID); err != nil {
+		return nil, err
+	}
+	return s.BlogStore.GetRevision(ctx, blogID, version)
+}
+
+func (s *tenantStore) ListRevisions(ctx context.Context, blogID primitive.ObjectID, beforeVersion int64, limit int) ([]Revision, error) {
+	if _, err := s.Get(ctx, blogID); err != nil {
+		return nil, err
+	}
+	return s.BlogStore.ListRevisions(ctx, blogID, beforeVersion, limit)
+}
+
+func (s *tenantStore) AddComment(ctx context.Context, c *CommentItem) (*CommentItem, error) {
+	if _, err := s.Get(ctx, c.BlogID); err != nil {
+		return nil, err
+	}
+	return s.BlogStore.AddComment(ctx, c)
+}
+
+func (s *tenantStore) GetComment(ctx context.Context, id primitive.ObjectID) (*CommentItem, error) {
+	c, err := s.BlogStore.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Get(ctx, c.BlogID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *tenantStore) ListComments(ctx context.Context, blogID primitive.ObjectID, parentID *primitive.ObjectID, after primitive.ObjectID, limit int) ([]CommentItem, error) {
+	if _, err := s.Get(ctx, blogID); err != nil {
+		return nil, err
+	}
+	return s.BlogStore.ListComments(ctx, blogID, parentID, after, limit)
+}
+
+func (s *tenantStore) DeleteComment(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	if _, err := s.GetComment(ctx, id); err != nil {
+		return 0, err
+	}
+	return s.BlogStore.DeleteComment(ctx, id)
+}
+
+func (s *tenantStore) CreateAuthor(ctx context.Context, a *AuthorItem) (*AuthorItem, error) {
+	scoped := *a
+	scoped.Tenant = TenantFromContext(ctx)
+	return s.BlogStore.CreateAuthor(ctx, &scoped)
+}
+
+// GetAuthor ignores the given tenant for the one of ctx.
+func (s *tenantStore) GetAuthor(ctx context.Context, tenant, id string) (*AuthorItem, error) {
+	return s.BlogStore.GetAuthor(ctx, TenantFromContext(ctx), id)
+}
+
+// UpdateAuthor ignores the given tenant for the one of ctx.
+func (s *tenantStore) UpdateAuthor(ctx context.Context, tenant, id string, u AuthorUpdate) (*AuthorItem, error) {
+	return s.BlogStore.UpdateAuthor(ctx, TenantFromContext(ctx), id, u)
+}
+
+// ListAuthors ignores the given tenant for the one of ctx.
+func (s *tenantStore) ListAuthors(ctx context.Context, tenant, after string, limit int) ([]AuthorItem, error) {
+	return s.BlogStore.ListAuthors(ctx, TenantFromContext(ctx), after, limit)
+}
+
+func (s *tenantStore) Atomically(ctx context.Context, fn func(ctx context.Context, tx BlogStore) error) error {
+	return s.BlogStore.Atomically(ctx, func(ctx context.Context, tx BlogStore) error {
+		return fn(ctx, &tenantStore{BlogStore: tx})
+	})
+}
+
+// Watch only passes on the changes to the blogs of the tenant.
+func (s *tenantStore) Watch(ctx context.Context, opts WatchOptions, fn func(*BlogEvent) error) error {
+	tenant := TenantFromContext(ctx)
+	return s.BlogStore.Watch(ctx, opts, func(ev *BlogEvent) error {
+		if ev.Tenant != tenant {
+			return nil
+		}
+		return fn(ev)
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	s, store := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	mustCreateAuthors(t, store, "a", "ann")
+	mustCreateAuthors(t, store, "b", "bob")
+	ctxA := ContextWithTenant(context.Background(), "a")
+	ctxB := ContextWithTenant(context.Background(), "b")
+	blog := mustCreateBlog(t, s, ctxA, "ann", "Shared title")
+
+	if _, err := s.ReadBlog(ctxB, &blogpb.ReadBlogRequest{BlogId: blog.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("ReadBlog from another tenant: error %v, want NOT_FOUND", err)
+	}
+	_, err := s.UpdateBlog(ctxB, &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: blog.GetId(), AuthorId: "bob", Title: "Taken"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateBlog from another tenant: error %v, want NOT_FOUND", err)
+	}
+	// the id is taken, but only in a tenant the caller cannot see
+	_, err = s.UpdateBlog(ctxB, &blogpb.UpdateBlogRequest{
+		AllowMissing: true,
+		Blog:         &blogpb.Blog{Id: blog.GetId(), AuthorId: "bob", Title: "Taken"},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateBlog with allow_missing on an id of another tenant: error %v, want NOT_FOUND", err)
+	}
+	if _, err := s.DeleteBlog(ctxB, &blogpb.DeleteBlogRequest{BlogId: blog.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteBlog from another tenant: error %v, want NOT_FOUND", err)
+	}
+
+	// slugs are unique per tenant
+	other := mustCreateBlog(t, s, ctxB, "bob", "Shared title")
+	if other.GetSlug() != blog.GetSlug() {
+		t.Errorf("same title in another tenant got the slug %q, want %q", other.GetSlug(), blog.GetSlug())
+	}
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want string
+	}{{ctxA, blog.GetId()}, {ctxB, other.GetId()}} {
+		var ids []string
+		err := s.store.List(tc.ctx, ListOptions{}, func(item *BlogItem) error {
+			ids = append(ids, item.ID.Hex())
+			return nil
+		})
+		if err != nil || len(ids) != 1 || ids[0] != tc.want {
+			t.Errorf("List of tenant %q = %v, %v, want only %v", TenantFromContext(tc.ctx), ids, err, tc.want)
+		}
+	}
+
+	read, err := s.ReadBlog(ctxA, &blogpb.ReadBlogRequest{BlogId: blog.GetId()})
+	if err != nil || read.GetBlog().GetTitle() != "Shared title" {
+		t.Errorf("blog after calls from another tenant = %v, %v, want it unchanged", read.GetBlog(), err)
+	}
+}
+
+func TestTenantAuthors(t *testing.T) {
+	s, _ := newTestServer(t, NewAllowAllPolicy(), Quotas{})
+	authors := NewAuthorServer(s.store, s.policy)
+	ctxA := ContextWithTenant(context.Background(), "a")
+	ctxB := ContextWithTenant(context.Background(), "b")
+
+	cat := &blogpb.Author{Id: "cat", DisplayName: "Cat", Email: "cat@a.example"}
+	if _, err := authors.CreateAuthor(ctxA, &blogpb.CreateAuthorRequest{Author: cat}); err != nil {
+		t.Fatalf("CreateAuthor: %v", err)
+	}
+
+	listed, err := authors.ListAuthors(ctxB, &blogpb.ListAuthorsRequest{})
+	if err != nil || len(listed.GetAuthors()) != 0 {
+		t.Errorf("ListAuthors from another tenant = %v, %v, want no authors", listed.GetAuthors(), err)
+	}
+	if _, err := authors.GetAuthor(ctxB, &blogpb.GetAuthorRequest{AuthorId: "cat"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetAuthor from another tenant: error %v, want NOT_FOUND", err)
+	}
+	_, err = authors.UpdateAuthor(ctxB, &blogpb.UpdateAuthorRequest{Author: &blogpb.Author{Id: "cat", DisplayName: "Taken"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateAuthor from another tenant: error %v, want NOT_FOUND", err)
+	}
+	_, err = s.CreateBlog(ctxB, &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "cat", Title: "Title"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateBlog by an author of another tenant: error %v, want INVALID_ARGUMENT", err)
+	}
+
+	// ids are unique per tenant
+	if _, err := authors.CreateAuthor(ctxB, &blogpb.CreateAuthorRequest{Author: &blogpb.Author{Id: "cat", DisplayName: "Other cat"}}); err != nil {
+		t.Fatalf("CreateAuthor of an id taken in another tenant: %v", err)
+	}
+	got, err := authors.GetAuthor(ctxA, &blogpb.GetAuthorRequest{AuthorId: "cat"})
+	if err != nil || got.GetAuthor().GetDisplayName() != "Cat" || got.GetAuthor().GetEmail() != cat.GetEmail() {
+		t.Errorf("author after calls from another tenant = %v, %v, want it unchanged", got.GetAuthor(), err)
+	}
+}
+
+func TestTenantQuotas(t *testing.T) {
+	s, store := newTestServer(t, NewAllowAllPolicy(), Quotas{Tenants: map[string]Quota{
+		"few":   {MaxBlogs: 1},
+		"small": {MaxBytes: 100},
+	}})
+	for _, tenant := range []string{"few", "small", "other"} {
+		mustCreateAuthors(t, store, tenant, "ann")
+	}
+	few := ContextWithTenant(context.Background(), "few")
+	small := ContextWithTenant(context.Background(), "small")
+	other := ContextWithTenant(context.Background(), "other")
+
+	mustCreateBlog(t, s, few, "ann", "First")
+	_, err := s.CreateBlog(few, &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "ann", Title: "Second"}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("blog past the quota of blogs: error %v, want RESOURCE_EXHAUSTED", err)
+	}
+	mustCreateBlog(t, s, other, "ann", "First")
+	mustCreateBlog(t, s, other, "ann", "Second")
+
+	_, err = s.CreateBlog(small, &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "ann", Title: "Big", Content: strings.Repeat("x", 100)}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("blog past the quota of bytes: error %v, want RESOURCE_EXHAUSTED", err)
+	}
+	mustCreateBlog(t, s, small, "ann", "Small")
+}
+
+func TestLoadQuotas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.txt")
+	lines := "# tenant blogs bytes\nacme 10 0\n\n- 5 1000\n"
+	if err := ioutil.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	def := Quota{MaxBlogs: 100}
+	quotas, err := LoadQuotas(path, def)
+	if err != nil {
+		t.Fatalf("LoadQuotas: %v", err)
+	}
+	for _, tt := range []struct {
+		tenant string
+		want   Quota
+	}{
+		{"acme", Quota{MaxBlogs: 10}},
+		{"", Quota{MaxBlogs: 5, MaxBytes: 1000}},
+		{"other", def},
+	} {
+		if got := quotas.forTenant(tt.tenant); got != tt.want {
+			t.Errorf("quota of %q = %+v, want %+v", tt.tenant, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"acme 10\n", "acme ten 0\n", "acme 10 -1\n"} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadQuotas(path, def); err == nil {
+			t.Errorf("LoadQuotas of %q succeeded, want an error", bad)
+		}
+	}
+}
+
+// TestTenantWatch replays the events of two tenants and checks that each
+// watcher only sees those of its own, purges included.
+func TestTenantWatch(t *testing.T) {
+	store := newMemoryStore()
+	scoped := NewTenantStore(store)
+	ctxA := ContextWithTenant(context.Background(), "a")
+	ctxB := ContextWithTenant(context.Background(), "b")
+	yes := true
+
+	trashed, err := scoped.Create(ctxA, &BlogItem{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scoped.Update(ctxA, trashed.ID, BlogUpdate{Deleted: &yes, UpdatedAt: now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Purge(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scoped.Create(ctxB, &BlogItem{Title: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	errDone := errors.New("done")
+	watch := func(ctx context.Context, n int) []EventType {
+		var types []EventType
+		err := scoped.Watch(ctx, WatchOptions{ResumeToken: store.events.id + ":0"}, func(ev *BlogEvent) error {
+			if ev.Tenant != TenantFromContext(ctx) {
+				t.Errorf("watcher of tenant %q got an event of tenant %q", TenantFromContext(ctx), ev.Tenant)
+			}
+			types = append(types, ev.Type)
+			if len(types) == n {
+				return errDone
+			}
+			return nil
+		})
+		if !errors.Is(err, errDone) {
+			t.Fatalf("Watch: %v", err)
+		}
+		return types
+	}
+
+	if got := watch(ctxA, 3); got[0] != EventCreated || got[1] != EventDeleted || got[2] != EventPurged {
+		t.Errorf("events of tenant a = %v, want created, deleted and purged", got)
+	}
+	if got := watch(ctxB, 1); got[0] != EventCreated {
+		t.Errorf("first event of tenant b = %v, want created", got)
+	}
+}
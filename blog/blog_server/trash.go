@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// purgeTrash permanently removes blogs that have been in the trash for
+// longer than retention, with their attachments, checking every interval
+// until ctx is done.
+func purgeTrash(ctx context.Context, store BlogStore, attachments AttachmentStore, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.Purge(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error while purging the trash: %v\n", err)
+		} else if len(purged) > 0 {
+			log.Printf("Purged %d blogs from the trash\n", len(purged))
+			purgeAttachments(ctx, attachments, purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeAttachments removes the attachments of purged blogs. Those it fails
+// to remove are logged and left behind.
+func purgeAttachments(ctx context.Context, attachments AttachmentStore, purged []BlogItem) {
+	for _, item := range purged {
+		for _, id := range item.AttachmentIDs {
+			err := attachments.Delete(ctx, id)
+			if err != nil && !errors.Is(err, ErrAttachmentNotFound) {
+				log.Printf("Error while removing the attachment %v of a purged blog: %v\n", id.Hex(), err)
+			}
+		}
+	}
+}
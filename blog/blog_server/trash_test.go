@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPurgeAttachments(t *testing.T) {
+	ctx := context.Background()
+	attachments, err := NewDirAttachmentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []primitive.ObjectID
+	for _, name := range []string{"a.txt", "b.txt", "kept.txt"} {
+		item := &AttachmentItem{ID: primitive.NewObjectID(), Filename: name, CreatedAt: now()}
+		if _, err := attachments.Put(ctx, item, strings.NewReader(name)); err != nil {
+			t.Fatalf("Put(%q): %v", name, err)
+		}
+		ids = append(ids, item.ID)
+	}
+
+	// an attachment already gone is skipped
+	purged := []BlogItem{{AttachmentIDs: []primitive.ObjectID{ids[0], primitive.NewObjectID()}}, {AttachmentIDs: ids[1:2]}}
+	purgeAttachments(ctx, attachments, purged)
+	for _, id := range ids[:2] {
+		if _, err := attachments.Get(ctx, id); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("Get of an attachment of a purged blog: error = %v, want %v", err, ErrAttachmentNotFound)
+		}
+	}
+	if _, err := attachments.Get(ctx, ids[2]); err != nil {
+		t.Errorf("Get of an attachment of no purged blog: %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxAuthorIDLength = 64
+	maxTitleLength    = 200
+	// maxContentSize is in bytes, the other limits count characters.
+	maxContentSize    = 1 << 20
+	maxCategoryLength = 64
+	maxTags           = 20
+	maxTagLength      = 50
+	maxQueryLength    = 200
+	maxFilenameLength = 255
+	maxCommentLength  = 10000
+
+	maxDisplayNameLength = 100
+	maxBioLength         = 2000
+	maxEmailLength       = 254
+)
+
+// stringRule declares the checks of a string field.
+type stringRule struct {
+	required bool
+	// maxLength counts characters and maxSize bytes, 0 meaning no limit
+	maxLength int
+	maxSize   int
+	// printable rejects control characters such as line breaks
+	printable bool
+	pattern   *regexp.Regexp
+	// patternHint describes the values pattern accepts
+	patternHint string
+}
+
+var (
+	idRule = stringRule{
+		required:    true,
+		pattern:     regexp.MustCompile(`^[0-9a-fA-F]{24}$`),
+		patternHint: "a 24 digit hexadecimal id",
+	}
+	authorIDRule = stringRule{
+		required:    true,
+		maxLength:   maxAuthorIDLength,
+		pattern:     regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`),
+		patternHint: "letters, digits, '.', '_' and '-', starting with a letter or digit",
+	}
+	titleRule    = stringRule{required: true, maxLength: maxTitleLength, printable: true}
+	contentRule  = stringRule{maxSize: maxContentSize}
+	categoryRule = stringRule{maxLength: maxCategoryLength, printable: true}
+	tagRule      = stringRule{maxLength: maxTagLength, printable: true}
+	// a slug may carry a collision suffix or a blog id after its words
+	slugRule     = stringRule{required: true, maxLength: maxSlugLength + 25, printable: true}
+	filenameRule = stringRule{required: true, maxLength: maxFilenameLength, printable: true}
+	commentRule  = stringRule{required: true, maxLength: maxCommentLength}
+	sha256Rule   = stringRule{
+		pattern:     regexp.MustCompile(`^[0-9a-fA-F]{64}$`),
+		patternHint: "64 hexadecimal digits",
+	}
+
+	displayNameRule = stringRule{required: true, maxLength: maxDisplayNameLength, printable: true}
+	bioRule         = stringRule{maxLength: maxBioLength}
+	emailRule       = stringRule{
+		maxLength:   maxEmailLength,
+		pattern:     regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+		patternHint: "an email address",
+	}
+)
+
+// blogFields declares the rules of the writable fields of a Blog, by their
+// update mask path.
+var blogFields = []struct {
+	path  string
+	check func(v *validator, field string, blog *blogpb.Blog)
+}{
+	{"author_id", func(v *validator, field string, blog *blogpb.Blog) {
+		v.string(field, blog.GetAuthorId(), authorIDRule)
+	}},
+	{"title", func(v *validator, field string, blog *blogpb.Blog) {
+		v.string(field, blog.GetTitle(), titleRule)
+	}},
+	{"content", func(v *validator, field string, blog *blogpb.Blog) {
+		v.string(field, blog.GetContent(), contentRule)
+	}},
+	{"tags", func(v *validator, field string, blog *blogpb.Blog) {
+		v.tags(field, blog.GetTags())
+	}},
+	{"category", func(v *validator, field string, blog *blogpb.Blog) {
+		v.string(field, blog.GetCategory(), categoryRule)
+	}},
+	{"content_format", func(v *validator, field string, blog *blogpb.Blog) {
+		if _, ok := blogpb.Blog_ContentFormat_name[int32(blog.GetContentFormat())]; !ok {
+			v.add(field, "is not a known format")
+		}
+	}},
+}
+
+// authorFields declares the rules of the writable fields of an Author, by
+// their update mask path.
+var authorFields = []struct {
+	path  string
+	check func(v *validator, field string, author *blogpb.Author)
+}{
+	{"display_name", func(v *validator, field string, author *blogpb.Author) {
+		v.string(field, author.GetDisplayName(), displayNameRule)
+	}},
+	{"bio", func(v *validator, field string, author *blogpb.Author) {
+		v.string(field, author.GetBio(), bioRule)
+	}},
+	{"email", func(v *validator, field string, author *blogpb.Author) {
+		v.string(field, author.GetEmail(), emailRule)
+	}},
+}
+
+// validator collects the field violations of a request.
+type validator struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *validator) add(field, description string) {
+	v.violations = append(v.violations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: description,
+	})
+}
+
+// err returns an INVALID_ARGUMENT status error carrying the violations in a
+// google.rpc.BadRequest detail, or nil when there are none.
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(v.violations))
+	for i, fv := range v.violations {
+		msgs[i] = fv.GetField() + " " + fv.GetDescription()
+	}
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("Invalid request: %s\n", strings.Join(msgs, "; ")))
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v.violations})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// fieldPath joins the path of a message and the name of one of its fields.
+func fieldPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func (v *validator) string(field, value string, rule stringRule) {
+	switch {
+	case value == "":
+		if rule.required {
+			v.add(field, "is required")
+		}
+	case rule.maxSize > 0 && len(value) > rule.maxSize:
+		v.add(field, fmt.Sprintf("is longer than %d bytes", rule.maxSize))
+	case rule.maxLength > 0 && utf8.RuneCountInString(value) > rule.maxLength:
+		v.add(field, fmt.Sprintf("is longer than %d characters", rule.maxLength))
+	case rule.printable && strings.IndexFunc(value, unicode.IsControl) >= 0:
+		v.add(field, "has control characters")
+	case rule.pattern != nil && !rule.pattern.MatchString(value):
+		v.add(field, "must be "+rule.patternHint)
+	}
+}
+
+// optionalID checks an id that may be left empty.
+func (v *validator) optionalID(field, value string) {
+	if value != "" {
+		v.string(field, value, idRule)
+	}
+}
+
+func (v *validator) tags(field string, tags []string) {
+	if len(tags) > maxTags {
+		v.add(field, fmt.Sprintf("has more than %d tags", maxTags))
+		return
+	}
+	for i, tag := range tags {
+		v.string(fmt.Sprintf("%s[%d]", field, i), strings.TrimSpace(tag), tagRule)
+	}
+}
+
+func (v *validator) nonNegative(field string, value int64) {
+	if value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func (v *validator) positive(field string, value int64) {
+	if value <= 0 {
+		v.add(field, "must be positive")
+	}
+}
+
+func (v *validator) timestamp(field string, ts *timestamppb.Timestamp) {
+	if ts != nil && ts.CheckValid() != nil {
+		v.add(field, "is not a valid time")
+	}
+}
+
+// isBlogField reports whether path names a writable field of a Blog.
+func isBlogField(path string) bool {
+	for _, f := range blogFields {
+		if f.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// blog checks the fields of blog at prefix named by paths, or all of them
+// when paths is empty. Paths naming no writable field are skipped.
+func (v *validator) blog(prefix string, blog *blogpb.Blog, paths []string) {
+	if blog == nil {
+		v.add(prefix, "is required")
+		return
+	}
+
+	if len(paths) == 0 {
+		for _, f := range blogFields {
+			f.check(v, fieldPath(prefix, f.path), blog)
+		}
+		if _, ok := blogpb.Blog_Status_name[int32(blog.GetStatus())]; !ok {
+			v.add(fieldPath(prefix, "status"), "is not a known status")
+		}
+		v.timestamp(fieldPath(prefix, "publish_at"), blog.GetPublishAt())
+		return
+	}
+
+	for _, path := range paths {
+		for _, f := range blogFields {
+			if f.path == path {
+				f.check(v, fieldPath(prefix, f.path), blog)
+			}
+		}
+	}
+}
+
+// isAuthorField reports whether path names a writable field of an Author.
+func isAuthorField(path string) bool {
+	for _, f := range authorFields {
+		if f.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// author checks the fields of author at prefix named by paths, or all of
+// them when paths is empty.
+func (v *validator) author(prefix string, author *blogpb.Author, paths []string) {
+	for _, f := range authorFields {
+		if len(paths) == 0 || containsPath(paths, f.path) {
+			f.check(v, fieldPath(prefix, f.path), author)
+		}
+	}
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRequest checks an UpdateBlogRequest at prefix.
+func (v *validator) updateRequest(prefix string, req *blogpb.UpdateBlogRequest) {
+	blogField := fieldPath(prefix, "blog")
+	if req.GetBlog() == nil {
+		v.add(blogField, "is required")
+		return
+	}
+	v.string(fieldPath(blogField, "id"), req.GetBlog().GetId(), idRule)
+	v.nonNegative(fieldPath(prefix, "expected_version"), req.GetExpectedVersion())
+
+	paths := req.GetUpdateMask().GetPaths()
+	for i, path := range paths {
+		if !isBlogField(path) {
+			v.add(fmt.Sprintf("%s.paths[%d]", fieldPath(prefix, "update_mask"), i), fmt.Sprintf("names the unknown or read-only field %q", path))
+		}
+	}
+	if req.GetAllowMissing() {
+		// the blog may be created from all its fields
+		paths = nil
+	}
+	v.blog(blogField, req.GetBlog(), paths)
+}
+
+// deleteRequest checks a DeleteBlogRequest at prefix.
+func (v *validator) deleteRequest(prefix string, req *blogpb.DeleteBlogRequest) {
+	v.string(fieldPath(prefix, "blog_id"), req.GetBlogId(), idRule)
+	v.nonNegative(fieldPath(prefix, "expected_version"), req.GetExpectedVersion())
+}
+
+// validate checks a BlogService, CommentService or AuthorService request,
+// returning INVALID_ARGUMENT with the fields at fault. Batch and import
+// items are checked one by one with validateBatch and validateBlog instead,
+// so a bad item only fails itself.
+func validate(req interface{}) error {
+	v := &validator{}
+	switch req := req.(type) {
+	case *blogpb.CreateBlogRequest:
+		v.blog("blog", req.GetBlog(), nil)
+	case *blogpb.ReadBlogRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+	case *blogpb.ReadBlogBySlugRequest:
+		v.string("slug", req.GetSlug(), slugRule)
+	case *blogpb.UpdateBlogRequest:
+		v.updateRequest("", req)
+	case *blogpb.DeleteBlogRequest:
+		v.deleteRequest("", req)
+	case *blogpb.UndeleteBlogRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.nonNegative("expected_version", req.GetExpectedVersion())
+	case *blogpb.PublishBlogRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.timestamp("publish_at", req.GetPublishAt())
+		v.nonNegative("expected_version", req.GetExpectedVersion())
+	case *blogpb.UnpublishBlogRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.nonNegative("expected_version", req.GetExpectedVersion())
+	case *blogpb.ListBlogRequest:
+		v.nonNegative("page_size", int64(req.GetPageSize()))
+		v.nonNegative("batch_size", int64(req.GetBatchSize()))
+		if rate := req.GetMaxRate(); !(rate >= 0) || math.IsInf(rate, 1) {
+			v.add("max_rate", "must be a non-negative number")
+		}
+		// filters on authors accept the ids stored before they were checked
+		v.string("author_id", req.GetAuthorId(), stringRule{maxLength: maxAuthorIDLength})
+		v.string("title_prefix", req.GetTitlePrefix(), stringRule{maxLength: maxTitleLength})
+		v.string("title_contains", req.GetTitleContains(), stringRule{maxLength: maxTitleLength})
+		v.timestamp("created_after", req.GetCreatedAfter())
+		v.timestamp("created_before", req.GetCreatedBefore())
+		if _, ok := blogpb.ListBlogRequest_OrderBy_name[int32(req.GetOrderBy())]; !ok {
+			v.add("order_by", "is not a known ordering")
+		}
+		v.tags("tags", req.GetTags())
+		v.string("category", req.GetCategory(), categoryRule)
+		for i, s := range req.GetStatuses() {
+			if _, ok := blogpb.Blog_Status_name[int32(s)]; !ok || s == blogpb.Blog_STATUS_UNSPECIFIED {
+				v.add(fmt.Sprintf("statuses[%d]", i), "is not a known status")
+			}
+		}
+	case *blogpb.SearchBlogsRequest:
+		v.string("query", strings.TrimSpace(req.GetQuery()), stringRule{required: true, maxLength: maxQueryLength})
+		v.nonNegative("limit", int64(req.GetLimit()))
+	case *blogpb.ListBlogRevisionsRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.nonNegative("page_size", int64(req.GetPageSize()))
+	case *blogpb.GetBlogRevisionRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.positive("version", req.GetVersion())
+	case *blogpb.DiffBlogRevisionsRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.positive("from_version", req.GetFromVersion())
+		v.nonNegative("to_version", req.GetToVersion())
+	case *blogpb.RevertBlogRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.positive("version", req.GetVersion())
+		v.nonNegative("expected_version", req.GetExpectedVersion())
+	case *blogpb.WatchBlogsRequest:
+		v.string("author_id", req.GetAuthorId(), stringRule{maxLength: maxAuthorIDLength})
+	case *blogpb.ListTagsRequest:
+		v.string("category", req.GetCategory(), categoryRule)
+	case *blogpb.UploadAttachmentRequest_Info:
+		v.string("info.filename", attachmentFilename(req.GetFilename()), filenameRule)
+		v.string("info.content_type", req.GetContentType(), stringRule{maxLength: maxFilenameLength, printable: true})
+		v.optionalID("info.blog_id", req.GetBlogId())
+		v.string("info.sha256", req.GetSha256(), sha256Rule)
+	case *blogpb.DownloadAttachmentRequest:
+		v.string("attachment_id", req.GetAttachmentId(), idRule)
+	case *blogpb.AddCommentRequest:
+		comment := req.GetComment()
+		if comment == nil {
+			v.add("comment", "is required")
+			break
+		}
+		v.string("comment.blog_id", comment.GetBlogId(), idRule)
+		v.optionalID("comment.parent_id", comment.GetParentId())
+		v.string("comment.author_id", comment.GetAuthorId(), authorIDRule)
+		v.string("comment.content", comment.GetContent(), commentRule)
+	case *blogpb.ListCommentsRequest:
+		v.string("blog_id", req.GetBlogId(), idRule)
+		v.optionalID("parent_id", req.GetParentId())
+		v.nonNegative("page_size", int64(req.GetPageSize()))
+	case *blogpb.DeleteCommentRequest:
+		v.string("comment_id", req.GetCommentId(), idRule)
+	case *blogpb.CreateAuthorRequest:
+		if req.GetAuthor() == nil {
+			v.add("author", "is required")
+			break
+		}
+		v.string("author.id", req.GetAuthor().GetId(), authorIDRule)
+		v.author("author", req.GetAuthor(), nil)
+	case *blogpb.GetAuthorRequest:
+		v.string("author_id", req.GetAuthorId(), authorIDRule)
+	case *blogpb.UpdateAuthorRequest:
+		if req.GetAuthor() == nil {
+			v.add("author", "is required")
+			break
+		}
+		v.string("author.id", req.GetAuthor().GetId(), authorIDRule)
+		paths := req.GetUpdateMask().GetPaths()
+		for i, path := range paths {
+			if !isAuthorField(path) {
+				v.add(fmt.Sprintf("update_mask.paths[%d]", i), fmt.Sprintf("names the unknown or read-only field %q", path))
+			}
+		}
+		v.author("author", req.GetAuthor(), paths)
+	case *blogpb.ListAuthorsRequest:
+		v.nonNegative("page_size", int64(req.GetPageSize()))
+	default:
+		return status.Errorf(codes.Internal, "No validation rules for %T\n", req)
+	}
+	return v.err()
+}
+
+// validateBlog checks a blog to create, at the path prefix.
+func validateBlog(prefix string, blog *blogpb.Blog) error {
+	v := &validator{}
+	v.blog(prefix, blog, nil)
+	return v.err()
+}
+
+// validateBatch checks the n items of a batch with check. An atomic batch
+// fails as a whole, with the violations of all its items, while the errors
+// of the items of other batches are returned for them to fail alone.
+func validateBatch(n int, atomic bool, check func(v *validator, i int)) ([]error, error) {
+	if atomic {
+		v := &validator{}
+		for i := 0; i < n; i++ {
+			check(v, i)
+		}
+		return make([]error, n), v.err()
+	}
+
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		v := &validator{}
+		check(v, i)
+		errs[i] = v.err()
+	}
+	return errs, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bogdan-user/grpc-go-course/blog/blogpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// violatedFields returns the fields of the BadRequest detail of err.
+func violatedFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v, want %v", st.Code(), codes.InvalidArgument)
+	}
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, fv := range br.GetFieldViolations() {
+				fields = append(fields, fv.GetField())
+			}
+		}
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	id := "0123456789abcdef01234567"
+	tests := []struct {
+		name string
+		req  interface{}
+		want []string
+	}{
+		{
+			name: "valid blog",
+			req:  &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{AuthorId: "ann", Title: "Title", Tags: []string{"go"}}},
+		},
+		{
+			name: "invalid blog",
+			req: &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{
+				AuthorId: "-ann",
+				Title:    "two\nlines",
+				Tags:     []string{strings.Repeat("t", maxTagLength+1)},
+			}},
+			want: []string{"blog.author_id", "blog.title", "blog.tags[0]"},
+		},
+		{
+			name: "missing blog",
+			req:  &blogpb.CreateBlogRequest{},
+			want: []string{"blog"},
+		},
+		{
+			name: "missing blog fields",
+			req:  &blogpb.CreateBlogRequest{Blog: &blogpb.Blog{}},
+			want: []string{"blog.author_id", "blog.title"},
+		},
+		{
+			name: "masked update only checks the masked fields",
+			req: &blogpb.UpdateBlogRequest{
+				Blog:       &blogpb.Blog{Id: id, Title: "New"},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+			},
+		},
+		{
+			name: "bad ids",
+			req:  &blogpb.ReadBlogRequest{BlogId: "42"},
+			want: []string{"blog_id"},
+		},
+		{
+			name: "negative versions",
+			req:  &blogpb.RevertBlogRequest{BlogId: id, Version: 0, ExpectedVersion: -1},
+			want: []string{"version", "expected_version"},
+		},
+		{
+			name: "bad list filters",
+			req: &blogpb.ListBlogRequest{
+				PageSize:     -1,
+				CreatedAfter: &timestamppb.Timestamp{Nanos: -1},
+				OrderBy:      99,
+				Statuses:     []blogpb.Blog_Status{blogpb.Blog_DRAFT, blogpb.Blog_STATUS_UNSPECIFIED},
+			},
+			want: []string{"page_size", "created_after", "order_by", "statuses[1]"},
+		},
+		{
+			name: "bad list pacing",
+			req:  &blogpb.ListBlogRequest{BatchSize: -1, MaxRate: math.NaN()},
+			want: []string{"batch_size", "max_rate"},
+		},
+		{
+			name: "blank query",
+			req:  &blogpb.SearchBlogsRequest{Query: "  "},
+			want: []string{"query"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := violatedFields(t, validate(tt.req)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if st := status.Convert(validate(struct{}{})); st.Code() != codes.Internal {
+		t.Errorf("validate of an unknown request: code %v, want %v", st.Code(), codes.Internal)
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	check := func(v *validator, i int) {
+		if i%2 == 1 {
+			v.add("item", "is odd")
+		}
+	}
+
+	errs, err := validateBatch(3, false, check)
+	if err != nil || errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Errorf("validateBatch = %v, %v, want only the second item to fail", errs, err)
+	}
+	if _, err := validateBatch(4, true, check); len(violatedFields(t, err)) != 2 {
+		t.Errorf("atomic validateBatch = %v, want the violations of both odd items", err)
+	}
+}
@@ -4,7 +4,9 @@ go 1.16
 
 require (
 	go.mongodb.org/mongo-driver v1.7.1
-	google.golang.org/genproto v0.0.0-20210825212027-de86158e7fda // indirect
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/text v0.3.5
+	google.golang.org/genproto v0.0.0-20210825212027-de86158e7fda
 	google.golang.org/grpc v1.40.0
 	google.golang.org/protobuf v1.27.1
 )